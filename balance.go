@@ -0,0 +1,29 @@
+package compasscard
+
+import "time"
+
+// BalancePoint is the card balance right after At
+type BalancePoint struct {
+	At      time.Time
+	Balance float64
+}
+
+// BalanceSeries returns the balance after each transaction, ordered by
+// DateTime. Records at the same instant collapse to the last one. records
+// is not modified
+func BalanceSeries(records []UsageRecord) []BalancePoint {
+	sorted := make([]UsageRecord, len(records))
+	copy(sorted, records)
+	SortByDate(sorted)
+
+	series := []BalancePoint{}
+	for _, record := range sorted {
+		point := BalancePoint{At: record.DateTime, Balance: record.BalanceDetails}
+		if n := len(series); n > 0 && series[n-1].At.Equal(point.At) {
+			series[n-1] = point
+			continue
+		}
+		series = append(series, point)
+	}
+	return series
+}
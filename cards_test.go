@@ -0,0 +1,90 @@
+package compasscard
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseCardsKeepsUnparseableCards(t *testing.T) {
+	doc, err := html.Parse(bytes.NewReader(fixture(t, "managecards.html")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := parseCards(doc)
+	if len(cards) != 3 {
+		t.Fatalf("expected 3 cards, got %d", len(cards))
+	}
+	if card := cards[0]; card.Err != nil || card.Balance != 17.90 || !card.AutoReloadEnabled || card.AutoReloadAmount != 20 {
+		t.Errorf("unexpected first card %+v", card)
+	}
+	if card := cards[1]; card.Err == nil || card.Balance != 0 || card.Nickname != "Spare" {
+		t.Errorf("expected the second card with a zero balance and an error, got %+v", card)
+	}
+	if card := cards[2]; card.Err == nil || card.Balance != 3.20 || card.AutoReloadThreshold != 0 {
+		t.Errorf("expected the third card with an error for its auto reload, got %+v", card)
+	}
+}
+
+func TestBalanceReportsCardErrors(t *testing.T) {
+	page := fixture(t, "managecards.html")
+	s, srv := newTestSession(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	cards, err := s.CardsDetailed()
+	if err != nil || len(cards) != 3 {
+		t.Fatalf("expected all 3 cards, got %d, %v", len(cards), err)
+	}
+	if balance, err := s.Balance("01234567890123456789"); err != nil || balance != 17.90 {
+		t.Errorf("expected a balance of 17.90, got %.2f, %v", balance, err)
+	}
+	if _, err := s.Balance("01234567890123456790"); err == nil || err.Error() != cards[1].Err.Error() {
+		t.Errorf("expected the card error, got %v", err)
+	}
+	if _, _, _, err := s.AutoReload("01234567890123456791"); err == nil {
+		t.Errorf("expected the auto reload error")
+	}
+}
+
+func TestCardsFollowsPages(t *testing.T) {
+	posts := []string{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		page := "Page$1"
+		if req.Method == http.MethodPost {
+			req.ParseForm()
+			page = req.PostForm.Get("__EVENTARGUMENT")
+			posts = append(posts, fmt.Sprintf("%s %s %s", req.PostForm.Get("__EVENTTARGET"), page, req.PostForm.Get("__VIEWSTATE")))
+		}
+		w.Write(fixture(t, fmt.Sprintf("managecards-page%s.html", strings.TrimPrefix(page, "Page$"))))
+	})
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	cards, err := s.Cards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"01234567890123450001", "01234567890123450002",
+		"01234567890123450003", "01234567890123450004",
+		"01234567890123450005",
+	}
+	if !reflect.DeepEqual(cards, want) {
+		t.Errorf("expected serials %q, got %q", want, cards)
+	}
+	// every page is posted back once, with the view state of the page linking to it
+	wantPosts := []string{
+		"ctl00$Content$gvCards Page$2 state-page1",
+		"ctl00$Content$gvCards Page$3 state-page2",
+	}
+	if !reflect.DeepEqual(posts, wantPosts) {
+		t.Errorf("expected postbacks %q, got %q", wantPosts, posts)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nicolai86/compasscard"
+)
+
+func main() {
+	username := flag.String("username", "", "compasscard.ca username, defaults to $COMPASS_USERNAME")
+	password := flag.String("password", "", "compasscard.ca password, defaults to $COMPASS_PASSWORD")
+	asJSON := flag.Bool("json", false, "print cards as json instead of a table")
+	flag.Parse()
+
+	if *username == "" {
+		*username = os.Getenv("COMPASS_USERNAME")
+	}
+	if *password == "" {
+		*password = os.Getenv("COMPASS_PASSWORD")
+	}
+	if *username == "" || *password == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	sess, err := compasscard.New(*username, *password)
+	if err != nil {
+		log.Fatalf("unable to sign in to compasscard.ca: %v", err)
+	}
+	cards, err := sess.CardsDetailed()
+	if err != nil {
+		log.Fatalf("unable to load cards from compasscard.ca: %v", err)
+	}
+	for _, card := range cards {
+		if card.Err != nil {
+			log.Printf("warning: %v", card.Err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cards); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tNICKNAME\tTYPE\tBALANCE")
+	for _, card := range cards {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\n", card.SerialNumber, card.Nickname, card.Type, card.Balance)
+	}
+	w.Flush()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// Cache stores usage records of past months
+type Cache interface {
+	Get(key string) ([]compasscard.UsageRecord, bool)
+	Put(key string, records []compasscard.UsageRecord)
+}
+
+// expired reports whether an entry stored at storedAt outlived ttl. A zero ttl never expires
+func expired(storedAt time.Time, ttl time.Duration, now func() time.Time) bool {
+	return ttl > 0 && now().Sub(storedAt) > ttl
+}
+
+type memoryEntry struct {
+	records  []compasscard.UsageRecord
+	storedAt time.Time
+}
+
+// memoryCache keeps records in process memory for ttl
+type memoryCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func newMemoryCache(ttl time.Duration, now func() time.Time) *memoryCache {
+	return &memoryCache{
+		ttl:     ttl,
+		now:     now,
+		entries: make(map[string]memoryEntry),
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]compasscard.UsageRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if expired(entry.storedAt, c.ttl, c.now) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.records, true
+}
+
+func (c *memoryCache) Put(key string, records []compasscard.UsageRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = memoryEntry{
+		records:  records,
+		storedAt: c.now(),
+	}
+}
+
+// fileStore keeps files inside dir. Files whose modification time is older
+// than ttl according to now are removed on access
+type fileStore struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+func (s fileStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// read returns the contents of name unless it is missing or expired
+func (s fileStore) read(name string) ([]byte, bool) {
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		return nil, false
+	}
+	if expired(info.ModTime(), s.ttl, s.now) {
+		os.Remove(s.path(name))
+		return nil, false
+	}
+	bs, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		return nil, false
+	}
+	return bs, true
+}
+
+// write stores bs as name, stamped with s.now
+func (s fileStore) write(name string, bs []byte) {
+	if err := ioutil.WriteFile(s.path(name), bs, 0644); err != nil {
+		log.Printf("unable to write cache file %q: %v\n", s.path(name), err)
+		return
+	}
+	// expiry compares the modification time against s.now, not the wall clock
+	now := s.now()
+	if err := os.Chtimes(s.path(name), now, now); err != nil {
+		log.Printf("unable to stamp cache file %q: %v\n", s.path(name), err)
+	}
+}
+
+// fileCache stores records as csv files named <key>.csv
+type fileCache struct {
+	fileStore
+}
+
+func (c *fileCache) Get(key string) ([]compasscard.UsageRecord, bool) {
+	bs, ok := c.read(key + ".csv")
+	if !ok {
+		return nil, false
+	}
+	records, err := compasscard.Parse(bs)
+	if err != nil {
+		log.Printf("ignoring unreadable cache file %q: %v\n", c.path(key+".csv"), err)
+		return nil, false
+	}
+	return records, true
+}
+
+func (c *fileCache) Put(key string, records []compasscard.UsageRecord) {
+	var buf bytes.Buffer
+	if err := compasscard.WriteCSV(&buf, records); err != nil {
+		log.Printf("unable to encode cache file %q: %v\n", c.path(key+".csv"), err)
+		return
+	}
+	c.write(key+".csv", buf.Bytes())
+}
+
+// tieredCache consults caches in order and backfills earlier caches on a hit
+type tieredCache []Cache
+
+func (c tieredCache) Get(key string) ([]compasscard.UsageRecord, bool) {
+	for i, cache := range c {
+		records, ok := cache.Get(key)
+		if !ok {
+			continue
+		}
+		for _, earlier := range c[:i] {
+			earlier.Put(key, records)
+		}
+		return records, true
+	}
+	return nil, false
+}
+
+func (c tieredCache) Put(key string, records []compasscard.UsageRecord) {
+	for _, cache := range c {
+		cache.Put(key, records)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// TestServeHTTPConcurrent is meant to run with -race
+func TestServeHTTPConcurrent(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newFakeServer(map[string][]compasscard.UsageRecord{
+		"1234": {usageRecord(2, -2.10)},
+		"5678": {usageRecord(3, -2.10)},
+	})
+	s.cache = tieredCache{s.cache, &fileCache{fileStore{dir: dir, now: fixedClock}}}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 64)
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ccsn := []string{"1234", "5678"}[i%2]
+			target := fmt.Sprintf("/%s?year=2018&month=%d", ccsn, 1+i%2)
+			codes <- get(s, httptest.NewRequest(http.MethodGet, target, nil)).Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, code)
+		}
+	}
+}
+
+func TestCacheKeyPerCard(t *testing.T) {
+	s := newFakeServer(map[string][]compasscard.UsageRecord{
+		"1234": {usageRecord(2, -2.10)},
+		"5678": {usageRecord(3, -3.15), usageRecord(4, -3.15)},
+	})
+	want := map[string]int{"1234": 1, "5678": 2}
+	for _, ccsn := range []string{"1234", "5678", "1234", "5678"} {
+		w := get(s, httptest.NewRequest(http.MethodGet, "/"+ccsn+"?year=2018&month=1", nil))
+		var resp response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.CCSN != ccsn || len(resp.Lines) != want[ccsn] {
+			t.Errorf("expected %d records of %s, got %d of %s", want[ccsn], ccsn, len(resp.Lines), resp.CCSN)
+		}
+	}
+	if cacheKey("1234", fixedClock()) == cacheKey("5678", fixedClock()) {
+		t.Errorf("expected cache keys to differ between cards")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	now := fixedClock()
+	clock := func() time.Time { return now }
+	records := []compasscard.UsageRecord{usageRecord(2, -2.10)}
+
+	caches := map[string]Cache{
+		"memory": newMemoryCache(time.Hour, clock),
+		"file":   &fileCache{fileStore{dir: dir, ttl: time.Hour, now: clock}},
+	}
+	for name, cache := range caches {
+		now = fixedClock()
+		cache.Put("1234-2018-01", records)
+
+		now = now.Add(59 * time.Minute)
+		if _, ok := cache.Get("1234-2018-01"); !ok {
+			t.Errorf("%s: expected a hit within the ttl", name)
+		}
+		now = now.Add(2 * time.Minute)
+		if _, ok := cache.Get("1234-2018-01"); ok {
+			t.Errorf("%s: expected the entry to expire after the ttl", name)
+		}
+		if _, ok := cache.Get("1234-2018-01"); ok {
+			t.Errorf("%s: expected the expired entry to be evicted", name)
+		}
+	}
+}
+
+func TestPDFCacheTTL(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	now := fixedClock()
+	cache := &pdfCache{fileStore{dir: dir, ttl: time.Hour, now: func() time.Time { return now }}}
+
+	cache.Put("1234-2018-01", []byte("%PDF-1.4"))
+	now = now.Add(59 * time.Minute)
+	if _, ok := cache.Get("1234-2018-01"); !ok {
+		t.Errorf("expected a hit within the ttl")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get("1234-2018-01"); ok {
+		t.Errorf("expected the statement to expire after the ttl")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nicolai86/compasscard"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// writeError responds with a JSON encoded errorResponse
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&errorResponse{
+		Error: err.Error(),
+		Code:  code,
+	})
+}
+
+// unknownCardsError lists requested cards which don't belong to the account
+type unknownCardsError struct {
+	ccsns []string
+}
+
+func (e *unknownCardsError) Error() string {
+	return fmt.Sprintf("unknown cards: %s", strings.Join(e.ccsns, ", "))
+}
+
+// upstreamStatus maps an error from compasscard.ca to a response status
+func upstreamStatus(err error) int {
+	var unknownCards *unknownCardsError
+	if errors.As(err, &unknownCards) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, compasscard.ErrCardNotFound) {
+		return http.StatusNotFound
+	}
+	if isAuthError(err) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadGateway
+}
+
+// isAuthError reports whether err means the server can't sign in to
+// compasscard.ca, e.g. rejected credentials, a captcha or a locked account
+func isAuthError(err error) bool {
+	return errors.Is(err, compasscard.ErrInvalidCredentials) ||
+		errors.Is(err, compasscard.ErrSessionExpired) ||
+		errors.Is(err, compasscard.ErrCaptchaRequired) ||
+		errors.Is(err, compasscard.ErrAccountLocked)
+}
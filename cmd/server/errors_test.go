@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/nicolai86/compasscard"
+)
+
+func TestUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{compasscard.ErrCardNotFound, http.StatusNotFound},
+		{&unknownCardsError{ccsns: []string{"1234"}}, http.StatusBadRequest},
+		{compasscard.ErrInvalidCredentials, http.StatusUnauthorized},
+		{compasscard.ErrSessionExpired, http.StatusUnauthorized},
+		{compasscard.ErrCaptchaRequired, http.StatusUnauthorized},
+		{fmt.Errorf("sign in: %w", compasscard.ErrAccountLocked), http.StatusUnauthorized},
+		{errors.New("connection reset"), http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		if got := upstreamStatus(test.err); got != test.want {
+			t.Errorf("%v: expected %d, got %d", test.err, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const fixtureCSV = `DateTime,Transaction,Product,LineItem,Amount,BalanceDetails,OrderDate,Payment,OrderNumber,AuthCode,Total
+Jan-30-2018 09:15 AM,Tap in at Main St,Stored Value,,-$2.10,$17.90,,,,,
+Jan-30-2018 06:08 PM,Tap in at Bus Stop 60980,Stored Value,,-$2.10,$15.80,,,,,
+`
+
+// writeFixture stores contents as name inside dir
+func writeFixture(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeFixtures(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	writeFixture(t, dir, "1234-2018-01.csv", fixtureCSV)
+	s := &server{cache: newMemoryCache(0, fixedClock), fixtures: dir, now: fixedClock}
+
+	for _, want := range []int{http.StatusOK, http.StatusOK} {
+		w := httptest.NewRecorder()
+		http.StripPrefix("/", s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/1234?year=2018&month=1", nil))
+		if w.Code != want {
+			t.Fatalf("expected status %d, got %d: %s", want, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-Record-Count"); got != "2" {
+			t.Errorf("expected 2 records, got %q", got)
+		}
+	}
+	if _, ok := s.cache.Get(cacheKey("1234", fixedClock().AddDate(0, -1, 0))); !ok {
+		t.Errorf("expected the past month to be cached")
+	}
+
+	w := httptest.NewRecorder()
+	http.StripPrefix("/", s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/5678?year=2018&month=1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected a missing fixture to be %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// readinessTTL is how long a credential check is reused by /readyz
+const readinessTTL = 5 * time.Minute
+
+// readinessTimeout bounds a single credential check, including signing out
+const readinessTimeout = 10 * time.Second
+
+type readiness struct {
+	username string
+	password string
+	now      func() time.Time
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// check signs in to compasscard.ca and signs out again, reusing the previous
+// result for readinessTTL
+func (r *readiness) check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.checkedAt.IsZero() && r.now().Sub(r.checkedAt) < readinessTTL {
+		return r.err
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	sess, err := compasscard.NewContext(checkCtx, r.username, r.password, compasscard.WithTimeout(readinessTimeout))
+	if err == nil {
+		if err := sess.Close(); err != nil {
+			log.Printf("unable to sign out after readiness check: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		// the client went away, don't keep its cancellation for readinessTTL
+		return err
+	}
+	r.err = err
+	r.checkedAt = r.now()
+	return r.err
+}
+
+// healthz handles GET /healthz without contacting compasscard.ca
+func healthz(w http.ResponseWriter, req *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// ServeHTTP handles GET /readyz by verifying the configured credentials
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := r.check(req.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// fixedClock pins the current month to February 2018
+func fixedClock() time.Time {
+	return time.Date(2018, time.February, 10, 12, 0, 0, 0, time.UTC)
+}
+
+// tempDir creates a directory removed by the returned func
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "compass-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// newFakeServer serves records from a compasscard.FakeSession. connect fails
+// once the request context is done
+func newFakeServer(records map[string][]compasscard.UsageRecord) *server {
+	fake := &compasscard.FakeSession{Records: records}
+	return &server{
+		connect: func(ctx context.Context) (compasscard.UsageFetcher, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return fake, nil
+		},
+		cache: newMemoryCache(0, fixedClock),
+		now:   fixedClock,
+	}
+}
+
+// get serves req the way main mounts s, below StripPrefix
+func get(s http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	http.StripPrefix("/", s).ServeHTTP(w, req)
+	return w
+}
+
+// usageRecord returns a tap in on day of January 2018
+func usageRecord(day int, amount float64) compasscard.UsageRecord {
+	return compasscard.UsageRecord{
+		DateTime:    time.Date(2018, time.January, day, 9, 15, 0, 0, compasscard.Vancouver),
+		Transaction: "Tap in at Main St",
+		Product:     "Stored Value",
+		Amount:      amount,
+		RawAmount:   math.Abs(amount),
+	}
+}
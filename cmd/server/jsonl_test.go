@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+func TestWriteJSONL(t *testing.T) {
+	records := []compasscard.UsageRecord{}
+	for day := 1; day <= 31; day++ {
+		records = append(records, usageRecord(day, -2.10))
+	}
+	s := newFakeServer(map[string][]compasscard.UsageRecord{"1234": records})
+
+	w := get(s, httptest.NewRequest(http.MethodGet, "/1234?year=2018&month=1&format=jsonl", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var record compasscard.UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d: %v", lines, err)
+		}
+		lines++
+	}
+	if lines != len(records) {
+		t.Errorf("expected %d lines, got %d", len(records), lines)
+	}
+}
+
+func TestStreamJSONLRange(t *testing.T) {
+	february := usageRecord(2, -2.10)
+	february.DateTime = february.DateTime.AddDate(0, 1, 0)
+	s := newFakeServer(map[string][]compasscard.UsageRecord{
+		"1234": {usageRecord(30, -2.10), usageRecord(2, -2.10), february, usageRecord(20, -3.15)},
+	})
+
+	w := get(s, httptest.NewRequest(http.MethodGet, "/1234?start=2018-01-10&end=2018-02-28&format=jsonl", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	dates := []time.Time{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var record struct {
+			Date time.Time `json:"date"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d: %v", len(dates), err)
+		}
+		dates = append(dates, record.Date)
+	}
+	want := []time.Time{usageRecord(20, 0).DateTime, usageRecord(30, 0).DateTime, february.DateTime}
+	if len(dates) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(dates))
+	}
+	for i := range want {
+		if !dates[i].Equal(want[i]) {
+			t.Errorf("line %d: expected %s, got %s", i, want[i], dates[i])
+		}
+	}
+	if _, ok := s.cache.Get(cacheKey("1234", usageRecord(1, 0).DateTime)); !ok {
+		t.Error("expected january to be cached")
+	}
+
+	w = get(s, httptest.NewRequest(http.MethodGet, "/9999?start=2018-01-10&end=2018-02-28&format=jsonl", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown card to be %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -1,154 +1,613 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/nicolai86/compasscard"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type server struct {
-	username string
-	password string
-	tmpdir   string
-	cache    map[string][]compasscard.UsageRecord
+	connect  func(ctx context.Context) (compasscard.UsageFetcher, error) // signs in to compasscard.ca
+	cache    Cache
+	pdfs     *pdfCache // caches statements of past months, may be nil
+	fixtures string    // serve csv fixtures from this directory instead of compasscard.ca
+	now      func() time.Time
 }
 
-func isCurrentMonth(date time.Time) bool {
-	now := time.Now()
-	beginningOfMonth := now.AddDate(0, 0, -now.Day()-1)
-	endOfMonth := beginningOfMonth.AddDate(0, 1, -1)
-	return date.After(beginningOfMonth) && date.Before(endOfMonth)
+// isCurrentMonth reports whether date falls into the month of s.now
+func (s *server) isCurrentMonth(date time.Time) bool {
+	now := s.now()
+	return date.Year() == now.Year() && date.Month() == now.Month()
+}
+
+// signIn returns a connect func creating a new Session per call
+func signIn(username, password string) func(ctx context.Context) (compasscard.UsageFetcher, error) {
+	return func(ctx context.Context) (compasscard.UsageFetcher, error) {
+		sess, err := compasscard.NewContext(ctx, username, password)
+		if err != nil {
+			return nil, err
+		}
+		return sess, nil
+	}
+}
+
+// session signs in and verifies ccsn belongs to the account. Callers close
+// the returned session
+func (s *server) session(ctx context.Context, ccsn string) (compasscard.UsageFetcher, error) {
+	sess, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := sess.CardExistsContext(ctx, ccsn)
+	if err == nil && !exists {
+		err = compasscard.ErrCardNotFound
+	}
+	if err != nil {
+		closeSession(sess)
+		return nil, err
+	}
+	return sess, nil
+}
+
+// closeSession signs out of sess. Failures are only logged, the lookup
+// using sess is done either way
+func closeSession(sess compasscard.UsageFetcher) {
+	if err := sess.Close(); err != nil {
+		log.Printf("unable to sign out: %v\n", err)
+	}
 }
 
 // TODO type loader
-func (s *server) lookup(date time.Time, ccsn string) ([]compasscard.UsageRecord, []byte, error) {
-	sess, err := compasscard.New(s.username, s.password)
+func (s *server) lookup(ctx context.Context, date time.Time, ccsn string) (records []compasscard.UsageRecord, skipped []compasscard.ParseError, err error) {
+	defer func(begin time.Time) { observeLookup(begin, err) }(time.Now())
+
+	if s.fixtures != "" {
+		return parseLeniently(s.fixtureRecords(ccsn, date))
+	}
+	sess, err := s.session(ctx, ccsn)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer closeSession(sess)
+	return parseLeniently(sess.UsageContext(ctx, ccsn, monthOptions(date)))
+}
+
+// parseLeniently re-parses raw with compasscard.ParseLenient if the strict
+// parse failed. Skipped rows are logged. skipped is nil unless the lenient
+// parser was used
+func parseLeniently(records []compasscard.UsageRecord, raw []byte, err error) ([]compasscard.UsageRecord, []compasscard.ParseError, error) {
+	var parseErr *compasscard.ParseError
+	if raw == nil || !errors.As(err, &parseErr) {
+		return records, nil, err
+	}
+	records, skipped := compasscard.ParseLenient(raw)
+	for _, e := range skipped {
+		log.Printf("skipped unparseable row: %v\n", &e)
+	}
+	return records, skipped, nil
+}
+
+// monthOptions covers the calendar month of date
+func monthOptions(date time.Time) compasscard.UsageOptions {
 	startDate := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
 	endDate := startDate.AddDate(0, 1, -1)
-	records, raw, err := sess.Usage(ccsn, compasscard.UsageOptions{
+	return compasscard.UsageOptions{
 		StartDate: startDate,
 		EndDate:   endDate,
-	})
-	return records, raw, err
-}
-
-// TODO type cached loader
-func (s *server) lookupAndCache(date time.Time, ccsn string) ([]compasscard.UsageRecord, error) {
-	key := date.Format("2006-01")
-	records, ok := s.cache[key]
-	if ok {
-		return records, nil
 	}
+}
 
-	cacheFile := fmt.Sprintf("%s/%s-%s.csv", s.tmpdir, ccsn, key)
+// lookupMultiple fetches the usage of several cards in parallel. Every ccsn
+// has to belong to the account, otherwise an unknownCardsError is returned
+func (s *server) lookupMultiple(ctx context.Context, date time.Time, ccsns []string) (usage map[string][]compasscard.UsageRecord, err error) {
+	defer func(begin time.Time) { observeLookup(begin, err) }(time.Now())
 
-	bs, err := ioutil.ReadFile(cacheFile)
-	if err == nil {
-		records, err := compasscard.Parse(bs)
-		if err != nil {
-			return nil, err
+	if s.fixtures != "" {
+		usage := map[string][]compasscard.UsageRecord{}
+		for _, ccsn := range ccsns {
+			records, _, err := s.fixtureRecords(ccsn, date)
+			if err != nil {
+				return nil, err
+			}
+			usage[ccsn] = records
+		}
+		return usage, nil
+	}
+	sess, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSession(sess)
+	cards, err := sess.CardsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, card := range cards {
+		known[card] = true
+	}
+	unknown := []string{}
+	for _, ccsn := range ccsns {
+		if !known[ccsn] {
+			unknown = append(unknown, ccsn)
 		}
-		s.cache[key] = records
-		return records, nil
 	}
+	if len(unknown) > 0 {
+		return nil, &unknownCardsError{ccsns: unknown}
+	}
+	return sess.UsageAll(ctx, ccsns, monthOptions(date))
+}
 
-	records, raw, err := s.lookup(date, ccsn)
+// lookupRange fetches the usage between start and end, one request per month
+func (s *server) lookupRange(ctx context.Context, start, end time.Time, ccsn string) (records []compasscard.UsageRecord, err error) {
+	defer func(begin time.Time) { observeLookup(begin, err) }(time.Now())
+
+	if s.fixtures != "" {
+		return s.fixtureRange(ccsn, start, end)
+	}
+	sess, err := s.session(ctx, ccsn)
 	if err != nil {
 		return nil, err
 	}
-	s.cache[key] = records
+	defer closeSession(sess)
+	return sess.UsageRangeContext(ctx, ccsn, start, end)
+}
+
+// cacheKey identifies the records of a card for the month of date. Both
+// the memory and the file cache share it, so different cards never collide
+func cacheKey(ccsn string, date time.Time) string {
+	return fmt.Sprintf("%s-%s", ccsn, date.Format("2006-01"))
+}
+
+// TODO type cached loader
+// Skipped rows are nil on a cache hit. Months with skipped rows aren't cached,
+// so they are fetched again once upstream is fixed
+func (s *server) lookupAndCache(ctx context.Context, date time.Time, ccsn string) ([]compasscard.UsageRecord, []compasscard.ParseError, error) {
+	key := cacheKey(ccsn, date)
+	if records, ok := s.cache.Get(key); ok {
+		cacheHits.Inc()
+		return records, nil, nil
+	}
+	cacheMisses.Inc()
 
-	err = ioutil.WriteFile(cacheFile, raw, 0644)
+	records, skipped, err := s.lookup(ctx, date, ccsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(skipped) == 0 {
+		s.cache.Put(key, records)
+	}
+	return records, skipped, nil
+}
 
-	return records, err
+// lookupMonth looks up the current month upstream and past months through the cache
+func (s *server) lookupMonth(ctx context.Context, date time.Time, ccsn string) ([]compasscard.UsageRecord, []compasscard.ParseError, error) {
+	if s.isCurrentMonth(date) {
+		return s.lookup(ctx, date, ccsn)
+	}
+	return s.lookupAndCache(ctx, date, ccsn)
 }
 
 type response struct {
-	Lines []compasscard.UsageRecord
-	CCSN  string
+	Lines  []compasscard.UsageRecord
+	CCSN   string
+	Window *window `json:",omitempty"`
+
+	// set when paginating with limit or offset. NextOffset is omitted on the last page
+	Total      *int `json:"total,omitempty"`
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// page is a limit and offset into the records of a json response
+type page struct {
+	limit  int // 0 means no limit
+	offset int
 }
 
-func (s *server) handle(w http.ResponseWriter, ccsn string, records []compasscard.UsageRecord) {
+// parsePage reads the limit and offset query parameters. ok is false if
+// neither is set
+func parsePage(req *http.Request) (p page, ok bool, err error) {
+	for _, param := range []struct {
+		name string
+		val  *int
+	}{{"limit", &p.limit}, {"offset", &p.offset}} {
+		raw := req.URL.Query().Get(param.name)
+		if raw == "" {
+			continue
+		}
+		ok = true
+		*param.val, err = strconv.Atoi(raw)
+		if err != nil || *param.val < 0 {
+			return page{}, false, fmt.Errorf("invalid %s %q", param.name, raw)
+		}
+	}
+	return p, ok, nil
+}
+
+// paginate sorts a copy of records by date and slices it to p. Offsets past
+// the end yield no records
+func paginate(records []compasscard.UsageRecord, p page) (lines []compasscard.UsageRecord, total int, next *int) {
+	sorted := make([]compasscard.UsageRecord, len(records))
+	copy(sorted, records)
+	compasscard.SortByDate(sorted)
+
+	total = len(sorted)
+	if p.offset >= total {
+		return []compasscard.UsageRecord{}, total, nil
+	}
+	end := total
+	if p.limit > 0 && p.offset+p.limit < total {
+		end = p.offset + p.limit
+		next = &end
+	}
+	return sorted[p.offset:end], total, next
+}
+
+// jsonlFlushEvery is the number of lines written between flushes in jsonl responses
+const jsonlFlushEvery = 100
+
+// jsonlWriter encodes records as json lines, flushing periodically so clients
+// can process records while the response is sent
+type jsonlWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+	lines   int
+}
+
+func newJSONLWriter(w http.ResponseWriter) *jsonlWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	return &jsonlWriter{enc: json.NewEncoder(w), flusher: flusher}
+}
+
+func (j *jsonlWriter) write(records []compasscard.UsageRecord) error {
+	for _, record := range records {
+		if err := j.enc.Encode(record); err != nil {
+			return err
+		}
+		j.lines++
+		if j.lines%jsonlFlushEvery == 0 {
+			j.flush()
+		}
+	}
+	return nil
+}
+
+func (j *jsonlWriter) flush() {
+	if j.flusher != nil {
+		j.flusher.Flush()
+	}
+}
+
+// writeJSONL writes one record per line
+func writeJSONL(w http.ResponseWriter, records []compasscard.UsageRecord) {
+	newJSONLWriter(w).write(records)
+}
+
+// streamJSONL writes the usage between start and end as json lines, one month
+// at a time, so only a single month is held in memory. Months are looked up
+// like single month requests, i.e. past months go through the cache.
+// X-Record-Count isn't known up front and not sent. Errors after the first
+// line truncate the response
+func (s *server) streamJSONL(w http.ResponseWriter, req *http.Request, ccsn string, start, end time.Time) {
+	out := newJSONLWriter(w)
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location()); !month.After(end); month = month.AddDate(0, 1, 0) {
+		records, _, err := s.lookupMonth(req.Context(), month, ccsn)
+		if errors.Is(err, compasscard.ErrNoData) {
+			continue
+		}
+		if err != nil && out.lines == 0 {
+			writeError(w, upstreamStatus(err), err)
+			return
+		}
+		if err != nil {
+			log.Printf("jsonl response for %s truncated: %v\n", ccsn, err)
+			return
+		}
+		inRange := []compasscard.UsageRecord{}
+		for _, record := range records {
+			if !record.DateTime.Before(start) && !record.DateTime.After(end) {
+				inRange = append(inRange, record)
+			}
+		}
+		compasscard.SortByDate(inRange)
+		if err := out.write(inRange); err != nil {
+			return
+		}
+		out.flush()
+	}
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// attachmentFilename builds a download name like compass-<ccsn>-2024-01.csv,
+// dropping characters which could break out of the header value
+func attachmentFilename(ccsn, period, ext string) string {
+	return fmt.Sprintf("compass-%s-%s.%s",
+		unsafeFilenameChars.ReplaceAllString(ccsn, ""),
+		unsafeFilenameChars.ReplaceAllString(period, ""),
+		ext,
+	)
+}
+
+// handle writes records in the requested format. period names the requested
+// month or range and is used for download filenames. A computed window is
+// included in json responses and as X-Window-Start/End headers. The number of
+// records is sent as X-Record-Count. json responses are paginated by the
+// limit and offset parameters
+func (s *server) handle(w http.ResponseWriter, req *http.Request, ccsn, period string, records []compasscard.UsageRecord, win *window) {
+	pg, paginated, err := parsePage(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("X-Record-Count", strconv.Itoa(len(records)))
+	if win != nil {
+		w.Header().Set("X-Window-Start", win.Start)
+		w.Header().Set("X-Window-End", win.End)
+	}
+	format := req.URL.Query().Get("format")
+	if format == "pdf" {
+		writeError(w, http.StatusBadRequest, errors.New("pdf statements are only available per month"))
+		return
+	}
+	if format == "jsonl" {
+		writeJSONL(w, records)
+		return
+	}
+	if format == "csv" || strings.Contains(req.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachmentFilename(ccsn, period, "csv")))
+		compasscard.WriteCSV(w, records)
+		return
+	}
+
 	resp := response{
-		CCSN:  ccsn,
-		Lines: records,
+		CCSN:   ccsn,
+		Lines:  records,
+		Window: win,
 	}
+	if paginated {
+		var total int
+		resp.Lines, total, resp.NextOffset = paginate(records, pg)
+		resp.Total = &total
+	}
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(&resp)
 }
 
-// ServeHTTP handles GET /ccsn?year&month usage
-func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ccsn := req.URL.Path
-	year, err := strconv.Atoi(req.URL.Query().Get("year"))
+const rangeLayout = "2006-01-02"
+
+// maxRangeMonths limits the span of a range request. Every month is a
+// request to compasscard.ca
+const maxRangeMonths = 24
+
+// serveRange handles GET /ccsn?start&end usage spanning up to maxRangeMonths
+func (s *server) serveRange(w http.ResponseWriter, req *http.Request, ccsn string) {
+	start, err := time.ParseInLocation(rangeLayout, req.URL.Query().Get("start"), compasscard.Vancouver)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	month, err := strconv.Atoi(req.URL.Query().Get("month"))
+	end, err := time.ParseInLocation(rangeLayout, req.URL.Query().Get("end"), compasscard.Vancouver)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if end.Before(start) {
+		writeError(w, http.StatusBadRequest, errors.New("end before start"))
+		return
+	}
+	if end.After(start.AddDate(0, maxRangeMonths, 0)) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("range longer than %d months", maxRangeMonths))
+		return
+	}
+
+	last := end.AddDate(0, 0, 1).Add(-time.Second)
+	if req.URL.Query().Get("format") == "jsonl" {
+		s.streamJSONL(w, req, ccsn, start, last)
+		return
+	}
+	records, err := s.lookupRange(req.Context(), start, last, ccsn)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+		writeError(w, upstreamStatus(err), err)
 		return
 	}
+	s.handle(w, req, ccsn, start.Format(rangeLayout)+"_"+end.Format(rangeLayout), records, nil)
+}
+
+// parseMonth reads the year and month query parameters
+func parseMonth(req *http.Request) (time.Time, error) {
+	year, err := strconv.Atoi(req.URL.Query().Get("year"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	month, err := strconv.Atoi(req.URL.Query().Get("month"))
+	if err != nil {
+		return time.Time{}, err
+	}
 	if month < 1 || month > 12 {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("month out of range [1, 12]"))
+		return time.Time{}, errors.New("month out of range [1, 12]")
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// serveMultiple handles GET /ccsn1,ccsn2?year&month usage, keyed by ccsn
+func (s *server) serveMultiple(w http.ResponseWriter, req *http.Request, ccsns []string) {
+	date, err := parseMonth(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	usage, err := s.lookupMultiple(req.Context(), date, ccsns)
+	if err != nil {
+		writeError(w, upstreamStatus(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
 
-	date := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	if isCurrentMonth(date) {
-		records, _, err := s.lookup(date, ccsn)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
+// setSkippedRows sets X-Skipped-Rows when the records were parsed leniently
+// for this request, i.e. skipped is not nil
+func setSkippedRows(w http.ResponseWriter, skipped []compasscard.ParseError) {
+	if skipped != nil {
+		w.Header().Set("X-Skipped-Rows", strconv.Itoa(len(skipped)))
+	}
+}
+
+var ccsnPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// ServeHTTP handles GET /ccsn?year&month, GET /ccsn?start&end and
+// GET /ccsn?period&anchor usage.
+// Multiple cards can be requested as a comma separated path or ccsn parameter
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	requestsTotal.Inc()
+	ccsn := req.URL.Path
+	if q := req.URL.Query().Get("ccsn"); q != "" {
+		ccsn = q
+	}
+	ccsns := strings.Split(ccsn, ",")
+	for _, c := range ccsns {
+		// ccsns end up in cache and fixture file names
+		if !ccsnPattern.MatchString(c) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ccsn %q", c))
 			return
 		}
-		s.handle(w, ccsn, records)
+	}
+	if len(ccsns) > 1 {
+		s.serveMultiple(w, req, ccsns)
+		return
+	}
+	if req.URL.Query().Get("period") != "" {
+		s.servePeriod(w, req, ccsn)
+		return
+	}
+	if req.URL.Query().Get("start") != "" || req.URL.Query().Get("end") != "" {
+		s.serveRange(w, req, ccsn)
 		return
 	}
 
-	records, err := s.lookupAndCache(date, ccsn)
+	date, err := parseMonth(req)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	s.handle(w, ccsn, records)
+	if req.URL.Query().Get("format") == "pdf" {
+		s.servePDF(w, req, ccsn, date)
+		return
+	}
+	records, skipped, err := s.lookupMonth(req.Context(), date, ccsn)
+	if err != nil {
+		writeError(w, upstreamStatus(err), err)
+		return
+	}
+	setSkippedRows(w, skipped)
+	s.handle(w, req, ccsn, date.Format("2006-01"), records, nil)
 }
 
 func main() {
-	username := flag.String("username", "", "compasscard.ca username")
-	password := flag.String("password", "", "compasscard.ca password")
+	username := flag.String("username", "", "compasscard.ca username, defaults to $COMPASS_USERNAME")
+	password := flag.String("password", "", "compasscard.ca password, defaults to $COMPASS_PASSWORD")
 	tmpdir := flag.String("cache-dir", "/tmp", "directory to cache past months")
+	cacheTTL := flag.Duration("cache-ttl", 0, "expire cached past months after this duration, 0 never expires")
 	listen := flag.String("listen", ":8080", "listen on port")
+	shutdownGrace := flag.Duration("shutdown-grace", 30*time.Second, "time to let in-flight requests finish on shutdown")
+	fixtures := flag.String("fixtures-dir", "", "serve <ccsn>-<year>-<month>.csv and .pdf files from this directory instead of compasscard.ca, caching in memory only")
 	flag.Parse()
 
-	if *username == "" || *password == "" {
+	if *username == "" {
+		*username = os.Getenv("COMPASS_USERNAME")
+	}
+	if *password == "" {
+		*password = os.Getenv("COMPASS_PASSWORD")
+	}
+	if *fixtures == "" && (*username == "" || *password == "") {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	// TODO verify creds
+	if *fixtures == "" {
+		sess, err := compasscard.New(*username, *password)
+		if err != nil {
+			log.Fatalf("unable to sign in to compasscard.ca: %v", err)
+		}
+		cards, err := sess.Cards()
+		if err != nil {
+			log.Fatalf("unable to load cards from compasscard.ca: %v", err)
+		}
+		closeSession(sess)
+		log.Printf("Signed in as %q with %d cards\n", *username, len(cards))
+	} else {
+		log.Printf("Serving fixtures from %q\n", *fixtures)
+	}
+
+	clock := time.Now
 	srv := server{
-		username: *username,
-		password: *password,
-		tmpdir:   *tmpdir,
-		cache:    make(map[string][]compasscard.UsageRecord),
+		connect:  signIn(*username, *password),
+		cache:    newMemoryCache(*cacheTTL, clock),
+		fixtures: *fixtures,
+		now:      clock,
+	}
+	// fixtures share cache keys with live data, keep them out of -cache-dir
+	if *fixtures == "" {
+		files := fileStore{dir: *tmpdir, ttl: *cacheTTL, now: clock}
+		srv.cache = tieredCache{
+			srv.cache,
+			&fileCache{files},
+		}
+		srv.pdfs = &pdfCache{files}
+	}
+	http.HandleFunc("/healthz", healthz)
+	http.Handle("/metrics", promhttp.Handler())
+	if *fixtures == "" {
+		http.Handle("/readyz", &readiness{
+			username: *username,
+			password: *password,
+			now:      clock,
+		})
+	} else {
+		http.HandleFunc("/readyz", healthz)
 	}
 	http.Handle("/", http.StripPrefix("/", &srv))
+
+	httpServer := &http.Server{
+		Addr:    *listen,
+		Handler: http.DefaultServeMux,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("Received %s, shutting down within %s\n", sig, *shutdownGrace)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownGrace)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown incomplete: %v\n", err)
+		}
+	}()
+
 	log.Printf("Listening on %q\n", *listen)
-	http.ListenAndServe(*listen, http.DefaultServeMux)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+	log.Println("Shutdown complete")
 }
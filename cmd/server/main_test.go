@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+func TestIsCurrentMonth(t *testing.T) {
+	tests := []struct {
+		now, date time.Time
+		want      bool
+	}{
+		{time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.February, 28, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2018, time.February, 28, 23, 0, 0, 0, time.UTC), time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2016, time.February, 29, 0, 0, 0, 0, time.UTC), time.Date(2016, time.March, 1, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2018, time.April, 30, 0, 0, 0, 0, time.UTC), time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2018, time.May, 31, 0, 0, 0, 0, time.UTC), time.Date(2018, time.June, 1, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2018, time.December, 31, 0, 0, 0, 0, time.UTC), time.Date(2018, time.December, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.December, 1, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, test := range tests {
+		now := test.now
+		s := &server{now: func() time.Time { return now }}
+		if got := s.isCurrentMonth(test.date); got != test.want {
+			t.Errorf("now %s, date %s: expected %v, got %v", test.now.Format("2006-01-02"), test.date.Format("2006-01-02"), test.want, got)
+		}
+	}
+}
+
+func TestCurrentMonthBypassesCache(t *testing.T) {
+	s := newFakeServer(map[string][]compasscard.UsageRecord{"1234": {usageRecord(2, -2.10)}})
+	connect := s.connect
+	lookups := 0
+	s.connect = func(ctx context.Context) (compasscard.UsageFetcher, error) {
+		lookups++
+		return connect(ctx)
+	}
+
+	for i := 0; i < 2; i++ {
+		get(s, httptest.NewRequest(http.MethodGet, "/1234?year=2018&month=2", nil))
+		get(s, httptest.NewRequest(http.MethodGet, "/1234?year=2018&month=1", nil))
+	}
+	if lookups != 3 {
+		t.Errorf("expected the current month to be fetched twice and the past month once, got %d lookups", lookups)
+	}
+	if _, ok := s.cache.Get(cacheKey("1234", fixedClock())); ok {
+		t.Errorf("expected the current month not to be cached")
+	}
+}
+
+func TestServeHTTPRejectsInvalidCCSN(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := &server{cache: newMemoryCache(0, fixedClock), fixtures: dir, now: fixedClock}
+
+	for _, target := range []string{
+		"/../secret?year=2018&month=1",
+		"/?ccsn=../../etc/passwd&year=2018&month=1",
+		"/?ccsn=1234,..%2Fsecret&year=2018&month=1",
+		"/?ccsn=1234,&year=2018&month=1",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		http.StripPrefix("/", s).ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/1234?year=2018&month=1", nil)
+	w := httptest.NewRecorder()
+	http.StripPrefix("/", s).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected a missing fixture to be %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "compass_server_requests_total",
+		Help: "Number of usage requests handled.",
+	})
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "compass_server_cache_hits_total",
+		Help: "Number of usage lookups served from cache.",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "compass_server_cache_misses_total",
+		Help: "Number of usage lookups not found in cache.",
+	})
+	lookupDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "compass_server_lookup_duration_seconds",
+		Help:    "Duration of usage lookups against compasscard.ca.",
+		Buckets: prometheus.DefBuckets,
+	})
+	authErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "compass_server_auth_errors_total",
+		Help: "Number of failed compasscard.ca sign ins, including captchas and locked accounts, and expired sessions.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, cacheHits, cacheMisses, lookupDuration, authErrors)
+}
+
+// observeLookup records the duration and auth failures of an upstream lookup
+func observeLookup(start time.Time, err error) {
+	lookupDuration.Observe(time.Since(start).Seconds())
+	if isAuthError(err) {
+		authErrors.Inc()
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// pdfCache stores official statements as <key>.pdf files, next to the csv
+// files of fileCache
+type pdfCache struct {
+	fileStore
+}
+
+func (c *pdfCache) Get(key string) ([]byte, bool) {
+	return c.read(key + ".pdf")
+}
+
+func (c *pdfCache) Put(key string, pdf []byte) {
+	c.write(key+".pdf", pdf)
+}
+
+// lookupPDF downloads the official statement of ccsn for the month of date
+func (s *server) lookupPDF(ctx context.Context, date time.Time, ccsn string) (pdf []byte, err error) {
+	defer func(begin time.Time) { observeLookup(begin, err) }(time.Now())
+
+	if s.fixtures != "" {
+		bs, err := ioutil.ReadFile(filepath.Join(s.fixtures, cacheKey(ccsn, date)+".pdf"))
+		if os.IsNotExist(err) {
+			return nil, compasscard.ErrCardNotFound
+		}
+		return bs, err
+	}
+	sess, err := s.session(ctx, ccsn)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSession(sess)
+	return sess.UsagePDFContext(ctx, ccsn, monthOptions(date))
+}
+
+// servePDF handles GET /ccsn?year&month&format=pdf. Statements of past
+// months are cached
+func (s *server) servePDF(w http.ResponseWriter, req *http.Request, ccsn string, date time.Time) {
+	key := cacheKey(ccsn, date)
+	cacheable := s.pdfs != nil && !s.isCurrentMonth(date)
+	var pdf []byte
+	cached := false
+	if cacheable {
+		pdf, cached = s.pdfs.Get(key)
+	}
+	if cached {
+		cacheHits.Inc()
+	} else {
+		cacheMisses.Inc()
+		var err error
+		pdf, err = s.lookupPDF(req.Context(), date, ccsn)
+		if err != nil {
+			writeError(w, upstreamStatus(err), err)
+			return
+		}
+		if cacheable {
+			s.pdfs.Put(key, pdf)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachmentFilename(ccsn, date.Format("2006-01"), "pdf")))
+	w.Write(pdf)
+}
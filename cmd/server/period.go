@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// periodPattern matches rolling period lengths like 4week or 14day
+var periodPattern = regexp.MustCompile(`^([1-9][0-9]*)(day|week)$`)
+
+// window is the first and last day of a computed period, both inclusive
+type window struct {
+	Start string
+	End   string
+}
+
+// periodDays parses a period like 4week into its length in days
+func periodDays(period string) (int, error) {
+	m := periodPattern.FindStringSubmatch(period)
+	if m == nil {
+		return 0, fmt.Errorf("invalid period %q, expected e.g. 4week or 14day", period)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, err
+	}
+	if m[2] == "week" {
+		n *= 7
+	}
+	return n, nil
+}
+
+// rollingWindow returns the start of the period of length days which contains
+// now, counting whole periods forwards or backwards from anchor. The returned
+// end is exclusive
+func rollingWindow(anchor, now time.Time, days int) (time.Time, time.Time) {
+	// count calendar days in UTC so daylight saving changes don't shift them
+	a := time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, time.UTC)
+	n := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	elapsed := int(n.Sub(a).Hours() / 24)
+	k := elapsed / days
+	if elapsed < 0 && elapsed%days != 0 {
+		k--
+	}
+	start := anchor.AddDate(0, 0, k*days)
+	return start, start.AddDate(0, 0, days)
+}
+
+// servePeriod handles GET /ccsn?period&anchor usage for the rolling period
+// containing today. anchor is the first day of any one period
+func (s *server) servePeriod(w http.ResponseWriter, req *http.Request, ccsn string) {
+	days, err := periodDays(req.URL.Query().Get("period"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	anchorParam := req.URL.Query().Get("anchor")
+	if anchorParam == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing anchor"))
+		return
+	}
+	anchor, err := time.ParseInLocation(rangeLayout, anchorParam, compasscard.Vancouver)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	start, end := rollingWindow(anchor, s.now().In(compasscard.Vancouver), days)
+	win := &window{
+		Start: start.Format(rangeLayout),
+		End:   end.AddDate(0, 0, -1).Format(rangeLayout),
+	}
+	if req.URL.Query().Get("format") == "jsonl" {
+		w.Header().Set("X-Window-Start", win.Start)
+		w.Header().Set("X-Window-End", win.End)
+		s.streamJSONL(w, req, ccsn, start, end.Add(-time.Second))
+		return
+	}
+	records, err := s.lookupRange(req.Context(), start, end.Add(-time.Second), ccsn)
+	if err != nil {
+		writeError(w, upstreamStatus(err), err)
+		return
+	}
+	s.handle(w, req, ccsn, win.Start+"_"+win.End, records, win)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nicolai86/compasscard"
+)
+
+func TestServeHTTPWithFakeSession(t *testing.T) {
+	s := newFakeServer(map[string][]compasscard.UsageRecord{
+		"1234": {usageRecord(2, -2.10), usageRecord(30, -2.10)},
+		"5678": {usageRecord(15, -3.15)},
+	})
+
+	w := get(s, httptest.NewRequest(http.MethodGet, "/1234?year=2018&month=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var resp response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.CCSN != "1234" || len(resp.Lines) != 2 {
+		t.Errorf("expected 2 records of 1234, got %d of %q", len(resp.Lines), resp.CCSN)
+	}
+
+	w = get(s, httptest.NewRequest(http.MethodGet, "/1234?start=2018-01-10&end=2018-01-31", nil))
+	if got := w.Header().Get("X-Record-Count"); w.Code != http.StatusOK || got != "1" {
+		t.Errorf("expected a single record in range, got %d with %q records", w.Code, got)
+	}
+
+	w = get(s, httptest.NewRequest(http.MethodGet, "/1234,5678?year=2018&month=1", nil))
+	usage := map[string][]json.RawMessage{}
+	if err := json.NewDecoder(w.Body).Decode(&usage); err != nil || len(usage["1234"]) != 2 || len(usage["5678"]) != 1 {
+		t.Errorf("expected usage of both cards, got %v, %v", usage, err)
+	}
+
+	w = get(s, httptest.NewRequest(http.MethodGet, "/9999?year=2018&month=1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown card to be %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServeHTTPUsesRequestContext(t *testing.T) {
+	s := newFakeServer(map[string][]compasscard.UsageRecord{"1234": {usageRecord(2, -2.10)}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, target := range []string{
+		"/1234?year=2018&month=1",
+		"/1234?year=2018&month=2",
+		"/1234?start=2018-01-01&end=2018-01-31",
+		"/1234?year=2018&month=1&format=pdf",
+	} {
+		w := get(s, httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s: expected a canceled request to be %d, got %d", target, http.StatusBadGateway, w.Code)
+		}
+	}
+}
+
+func TestServeRangeLimitsSpan(t *testing.T) {
+	s := newFakeServer(map[string][]compasscard.UsageRecord{"1234": {usageRecord(2, -2.10)}})
+
+	for target, code := range map[string]int{
+		"/1234?start=2016-01-01&end=2018-01-01": http.StatusOK,
+		"/1234?start=2016-01-01&end=2018-01-02": http.StatusBadRequest,
+		"/1234?start=1900-01-01&end=2018-01-31": http.StatusBadRequest,
+	} {
+		w := get(s, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != code {
+			t.Errorf("%s: expected %d, got %d: %s", target, code, w.Code, w.Body)
+		}
+	}
+}
+
+// closeCounter counts the sessions closed by the server
+type closeCounter struct {
+	*compasscard.FakeSession
+	closed *int
+}
+
+func (c closeCounter) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestServeHTTPClosesSessions(t *testing.T) {
+	fake := &compasscard.FakeSession{
+		Records: map[string][]compasscard.UsageRecord{"1234": {usageRecord(2, -2.10)}, "5678": {}},
+		PDFs:    map[string][]byte{"1234": []byte("%PDF-1.4")},
+	}
+	s := newFakeServer(nil)
+	opened, closed := 0, 0
+	s.connect = func(ctx context.Context) (compasscard.UsageFetcher, error) {
+		opened++
+		return closeCounter{fake, &closed}, nil
+	}
+
+	for _, target := range []string{
+		"/1234?year=2018&month=1",
+		"/1234?start=2018-01-01&end=2018-01-31",
+		"/1234,5678?year=2018&month=1",
+		"/1234?year=2018&month=2&format=pdf",
+		"/9999?year=2018&month=2",
+	} {
+		get(s, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if opened != 5 || closed != opened {
+		t.Errorf("expected 5 sessions to be opened and closed, got %d opened and %d closed", opened, closed)
+	}
+}
@@ -0,0 +1,67 @@
+package compasscard
+
+import "strings"
+
+// requiredColumns must be present in every usage record
+var requiredColumns = []string{"DateTime", "Amount", "BalanceDetails"}
+
+// columnAliases maps normalized header names to UsageRecord fields
+var columnAliases = map[string]string{
+	"date":     "DateTime",
+	"time":     "DateTime",
+	"balance":  "BalanceDetails",
+	"location": "LineItem",
+}
+
+// columnIndex maps UsageRecord field names to csv column positions
+type columnIndex map[string]int
+
+// defaultColumns assumes the column order of usageHeader
+func defaultColumns() columnIndex {
+	columns := columnIndex{}
+	for i, name := range usageHeader {
+		columns[name] = i
+	}
+	return columns
+}
+
+func normalizeColumn(name string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// newColumnIndex maps the header row to field names, so additional columns
+// such as Subsidy on subsidized cards don't shift the remaining fields.
+// Headers without any known column fall back to the default order
+func newColumnIndex(header []string) columnIndex {
+	known := map[string]string{}
+	for _, name := range usageHeader {
+		known[normalizeColumn(name)] = name
+	}
+	for alias, name := range columnAliases {
+		known[alias] = name
+	}
+
+	columns := columnIndex{}
+	for i, column := range header {
+		name, ok := known[normalizeColumn(column)]
+		if !ok {
+			continue
+		}
+		if _, seen := columns[name]; !seen {
+			columns[name] = i
+		}
+	}
+	if len(columns) == 0 {
+		return defaultColumns()
+	}
+	return columns
+}
+
+// value returns the field of line, reporting false if the column is missing
+func (c columnIndex) value(line []string, field string) (string, bool) {
+	i, ok := c[field]
+	if !ok || i >= len(line) {
+		return "", false
+	}
+	return line[i], true
+}
@@ -1,29 +1,99 @@
+// Package compasscard fetches usage data from compasscard.ca.
+//
+// Parse, ParseFunc, ParseRecord and WriteCSV work on previously downloaded
+// csv statements and never need a Session or network access.
 package compasscard
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/http/httputil"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	_ "time/tzdata" // Vancouver must not depend on the system timezone database
 
 	"golang.org/x/net/html"
+	"golang.org/x/time/rate"
 )
 
-const endpoint = "https://www.compasscard.ca"
+const defaultEndpoint = "https://www.compasscard.ca"
+
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/76.0.3809.100 Safari/537.36"
+
+// ErrInvalidCredentials is returned when compasscard.ca rejects the sign in
+var ErrInvalidCredentials = errors.New("compasscard: invalid credentials")
+
+// ErrCaptchaRequired is returned when compasscard.ca asks for a captcha on sign in
+var ErrCaptchaRequired = errors.New("compasscard: captcha required")
+
+// ErrAccountLocked is returned when compasscard.ca locked the account after failed sign ins
+var ErrAccountLocked = errors.New("compasscard: account locked")
+
+// ErrNoData is returned by Usage when retries are enabled via WithRetry and
+// the statement is still empty after retrying. UsageRange and UsageAll treat
+// it as a period without records
+var ErrNoData = errors.New("compasscard: no usage data")
+
+// ErrSessionExpired is returned when compasscard.ca answers with the sign in
+// page instead of the requested content. Sign in again to continue
+var ErrSessionExpired = errors.New("compasscard: session expired")
+
+// ErrCardNotFound is returned when a card is not registered with the account
+var ErrCardNotFound = errors.New("compasscard: card not found")
+
+// ErrClosed is returned by methods of a Session after Close
+var ErrClosed = errors.New("compasscard: session closed")
+
+// ErrSignoutFailed is returned when compasscard.ca still reports an authenticated session after signing out
+var ErrSignoutFailed = errors.New("compasscard: sign out failed")
+
+// Logger receives debug output from a Session
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(format string, args ...interface{}) {}
 
 type Session struct {
-	client *http.Client
+	client    *http.Client
+	logger    Logger
+	endpoint  string
+	userAgent string
+
+	attempts    int           // number of tries for GET requests
+	backoff     time.Duration // delay before the first retry, doubled afterwards
+	concurrency int           // maximum parallel requests in UsageAll
+	skipLogin   bool
+	limiter     *rate.Limiter // gates every outbound request, nil means unlimited
+	recorder    func(name string, body []byte)
+	trace       func() *httptrace.ClientTrace
+	debug       io.Writer // receives wire dumps of every request and response
+	debugMu     sync.Mutex
 
 	csrfToken      string // __CSRFTOKEN
 	evntValidation string // __EVENTVALIDATION
 	evntState      string // __VIEWSTATE
 	evntGenerator  string // __VIEWSTATEGENERATOR
+
+	emailField    string // name of the SignIn email input
+	passwordField string // name of the SignIn password input
 }
 
 func captureInput(name string, val *string, n *html.Node) {
@@ -41,13 +111,270 @@ func captureInput(name string, val *string, n *html.Node) {
 	}
 }
 
-func (s *Session) populateCSRF() error {
-	resp, err := s.client.Get(fmt.Sprintf("%s/SignIn", endpoint))
+// get fetches url, retrying transient failures when configured via WithRetry
+func (s *Session) get(ctx context.Context, url string) (*http.Response, error) {
+	return s.getWithHeader(ctx, url, nil)
+}
+
+// getWithHeader is like get but adds header to every attempt
+func (s *Session) getWithHeader(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	delay := s.backoff
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := s.do(req)
+		if err == nil || attempt >= s.attempts || !isTransient(ctx, err) {
+			return resp, err
+		}
+
+		s.logger.Printf("compasscard: retrying GET %s in %s after attempt %d", url, delay, attempt)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether a failed request is worth retrying
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+func (s *Session) postForm(ctx context.Context, url string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// do sends req. A status other than 200 is reported as *StatusError alongside
+// the response, whose body is already closed
+func (s *Session) do(req *http.Request) (*http.Response, error) {
+	if s.client == nil {
+		return nil, ErrClosed
+	}
+	if s.limiter != nil {
+		if err := s.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	req.Header.Set("User-Agent", s.userAgent)
+	if s.trace != nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), s.trace()))
+	}
+	s.logger.Printf("compasscard: %s %s", req.Method, req.URL)
+	if s.debug != nil {
+		if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+			s.writeDebug(s.redact(dump))
+		}
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Printf("compasscard: %s %s failed: %v", req.Method, req.URL, err)
+		return nil, err
+	}
+	if s.debug != nil {
+		if dump, err := httputil.DumpResponse(resp, true); err == nil {
+			s.writeDebug(dump)
+		}
+	}
+	s.logger.Printf("compasscard: %s %s: %s (final url %s)", req.Method, req.URL, resp.Status, resp.Request.URL)
+	if resp.StatusCode != http.StatusOK {
+		defer closeBody(resp)
+		return resp, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			URL:        resp.Request.URL.String(),
+			Message:    errorMessage(resp),
+		}
+	}
+	return resp, nil
+}
+
+// redactPasswords matches url encoded form values whose name contains password
+var redactPasswords = regexp.MustCompile(`(?i)([^&\s=]*password[^&\s=]*=)[^&\s]*`)
+
+// redact replaces password values in a request dump, including the value of
+// the scraped SignIn password input whatever its name
+func (s *Session) redact(dump []byte) []byte {
+	dump = redactPasswords.ReplaceAll(dump, []byte("${1}REDACTED"))
+	field := s.passwordField
+	if field == "" {
+		field = defaultPasswordField
+	}
+	named := regexp.MustCompile(`(^|[&\s])(` + regexp.QuoteMeta(url.QueryEscape(field)) + `=)[^&\s]*`)
+	return named.ReplaceAll(dump, []byte("${1}${2}REDACTED"))
+}
+
+// writeDebug writes a single dump to the writer set via WithDebugHTTP
+func (s *Session) writeDebug(dump []byte) {
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+	s.debug.Write(dump)
+	io.WriteString(s.debug, "\n\n")
+}
+
+// maxDrain bounds how much of an unread body is discarded to reuse the connection
+const maxDrain = 64 << 10
+
+// closeBody drains and closes resp.Body so the http.Client can reuse the
+// keep-alive connection
+func closeBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrain))
+	resp.Body.Close()
+}
+
+// readBody reads the response body, passing it to the recorder set via
+// WithResponseRecorder. gzip bodies are decompressed; the transport only does
+// so itself when the request didn't set Accept-Encoding
+func (s *Session) readBody(name string, resp *http.Response) ([]byte, error) {
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	bs, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if s.recorder != nil {
+		s.recorder(name, bs)
+	}
+	return bs, nil
+}
+
+func (s *Session) parseHTML(name string, resp *http.Response) (*html.Node, error) {
+	bs, err := s.readBody(name, resp)
+	if err != nil {
+		return nil, err
+	}
+	return html.Parse(bytes.NewReader(bs))
+}
+
+// StatusError is returned when compasscard.ca responds with a status other than 200 OK
+type StatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Message    string // title or first heading of an html error page, may be empty
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("compasscard: unexpected status %s from %s: %s", e.Status, e.URL, e.Message)
+	}
+	return fmt.Sprintf("compasscard: unexpected status %s from %s", e.Status, e.URL)
+}
+
+// maxErrorMessage bounds the length of StatusError.Message in runes
+const maxErrorMessage = 120
+
+// errorMessage extracts the title, or failing that the first h1 or h2, of an
+// html error response. Other content types yield an empty message
+func errorMessage(resp *http.Response) string {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return ""
+	}
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return ""
+		}
+		defer gz.Close()
+		body = gz
+	}
+	doc, err := html.Parse(io.LimitReader(body, maxDrain))
+	if err != nil {
+		return ""
+	}
+	var title, heading string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "title" && title == "":
+				title = textContent(n)
+			case (n.Data == "h1" || n.Data == "h2") && heading == "":
+				heading = textContent(n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	message := title
+	if message == "" {
+		message = heading
+	}
+	message = strings.Join(strings.Fields(message), " ")
+	if runes := []rune(message); len(runes) > maxErrorMessage {
+		message = string(runes[:maxErrorMessage-1]) + "…"
+	}
+	return message
+}
+
+// postAction posts the form returned by build to page. ASP.NET form tokens
+// expire, so when compasscard.ca answers by redirecting to SignIn the tokens
+// are re-fetched from page and the post is retried once
+func (s *Session) postAction(ctx context.Context, page string, build func() url.Values) (*http.Response, error) {
+	target := fmt.Sprintf("%s/%s", s.endpoint, page)
+	resp, err := s.postForm(ctx, target, build())
+	if err != nil || page == "SignIn" || !redirectedToSignIn(resp) {
+		return resp, err
+	}
+	closeBody(resp)
+
+	s.logger.Printf("compasscard: POST %s redirected to SignIn, retrying with fresh tokens", target)
+	if err := s.populateTokens(ctx, page); err != nil {
+		return nil, err
+	}
+	return s.postForm(ctx, target, build())
+}
+
+func redirectedToSignIn(resp *http.Response) bool {
+	return resp.Request != nil && strings.EqualFold(resp.Request.URL.Path, "/SignIn")
+}
+
+// isSignInBody reports whether a response which should be csv contains the sign in form instead
+func isSignInBody(raw []byte) bool {
+	return bytes.Contains(raw, []byte("ctl00$txtSignInEmail")) || bytes.Contains(raw, []byte("ctl00$Content$emailInfo$txtEmail"))
+}
+
+func (s *Session) populateCSRF(ctx context.Context) error {
+	return s.populateTokens(ctx, "SignIn")
+}
+
+// populateTokens captures the ASP.NET form tokens rendered on page
+func (s *Session) populateTokens(ctx context.Context, page string) error {
+	resp, err := s.get(ctx, fmt.Sprintf("%s/%s", s.endpoint, page))
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	doc, err := html.Parse(resp.Body)
+	defer closeBody(resp)
+	doc, err := s.parseHTML(page, resp)
 	if err != nil {
 		return err
 	}
@@ -66,17 +393,72 @@ func (s *Session) populateCSRF() error {
 	}
 	f(doc)
 
+	if page == "SignIn" {
+		s.emailField, s.passwordField = loginFields(doc)
+	}
 	return nil
 }
 
+// the SignIn inputs used when the form can't be scraped
+const (
+	defaultEmailField    = "ctl00$Content$emailInfo$txtEmail"
+	defaultPasswordField = "ctl00$Content$passwordInfo$txtPassword"
+)
+
+// loginFields finds the names of the email and password inputs of the sign
+// in form. The page header repeats both inputs, so inputs of the main
+// content form are preferred. Missing inputs fall back to the defaults
+func loginFields(doc *html.Node) (email, password string) {
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "input" {
+			name, _ := attrValue(n, "name")
+			typ, _ := attrValue(n, "type")
+			typ = strings.ToLower(typ)
+			switch {
+			case typ == "email" || (typ == "text" && strings.Contains(strings.ToLower(name), "email")):
+				preferField(&email, name)
+			case typ == "password":
+				preferField(&password, name)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	if email == "" {
+		email = defaultEmailField
+	}
+	if password == "" {
+		password = defaultPasswordField
+	}
+	return email, password
+}
+
+// preferField sets *field to name unless it already holds a content form input
+func preferField(field *string, name string) {
+	if name != "" && (*field == "" || (!isContentField(*field) && isContentField(name))) {
+		*field = name
+	}
+}
+
+// isContentField reports whether name belongs to the main content form
+func isContentField(name string) bool {
+	return strings.HasPrefix(name, "ctl00$Content$")
+}
+
 type UsageRecord struct {
 	DateTime       time.Time
 	Transaction    string
 	Product        string
 	LineItem       string
-	Amount         float64
+	Amount         float64 // negative for spend, positive for credits, see Classify
+	RawAmount      float64 // unsigned Amount as printed in the statement
 	BalanceDetails float64
-	OrderDate      string
+	OrderDate      string    // as printed in the statement
+	OrderedAt      time.Time // OrderDate parsed, zero if empty or unrecognized
 	Payment        string
 	OrderNumber    string
 	AuthCode       string
@@ -86,109 +468,479 @@ type UsageRecord struct {
 type UsageOptions struct {
 	StartDate time.Time
 	EndDate   time.Time
+
+	// TransactionTypes limits the returned records to those whose Transaction
+	// starts with one of the given values, ignoring case. Observed values
+	// include "Tap in", "Tap out", "Transfer", "Loaded", "AutoLoad",
+	// "Purchase" and "Fare Adjustment". Empty returns all records
+	TransactionTypes []string
+
+	// ReportType selects the statement report, defaulting to 2 (usage)
+	ReportType int
+	// Raw omits the csv=true parameter. Usage then returns the unparsed
+	// body without records
+	Raw bool
+}
+
+// filterTransactions returns the records matching one of types
+func filterTransactions(records []UsageRecord, types []string) []UsageRecord {
+	if len(types) == 0 {
+		return records
+	}
+	filtered := []UsageRecord{}
+	for _, record := range records {
+		transaction := strings.ToLower(record.Transaction)
+		for _, t := range types {
+			if strings.HasPrefix(transaction, strings.ToLower(t)) {
+				filtered = append(filtered, record)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+const usageRecordLayout = "Jan-02-2006 03:04 PM" // Jan-30-2018 06:08 PM
+
+// usageRecordLayouts are tried in order when parsing, since some rows omit
+// the leading zero of the hour
+var usageRecordLayouts = []string{
+	usageRecordLayout,
+	"Jan-02-2006 3:04 PM", // Jan-30-2018 6:08 PM
+}
+
+// orderDateLayouts are tried after usageRecordLayouts for OrderDate values.
+// Slash separated dates are left out, they are ambiguous between day and month
+var orderDateLayouts = []string{
+	"2006-01-02",
+}
+
+// parseOrderDate parses OrderDate leniently since its format varies between
+// products; unrecognized values yield the zero time
+func parseOrderDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if t, err := parseUsageTime(value); err == nil {
+		return t
+	}
+	for _, layout := range orderDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, Vancouver); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func parseUsageTime(value string) (time.Time, error) {
+	var err error
+	for _, layout := range usageRecordLayouts {
+		var t time.Time
+		t, err = time.ParseInLocation(layout, value, Vancouver)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Vancouver is the timezone compasscard.ca renders timestamps in, including
+// daylight saving time. The timezone database is embedded
+var Vancouver = mustLoadLocation("America/Vancouver")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
 }
 
-const usageRecordLayout = "Jan-02-2006 15:04 PM" // Jan-30-2018 06:08 PM
+// CurrencyTokens are stripped from either end of amounts before parsing.
+// Override it to support other localized exports
+var CurrencyTokens = []string{"$", "CAD"}
+
+func stripCurrency(val string) string {
+	for _, token := range CurrencyTokens {
+		val = strings.TrimSpace(strings.TrimPrefix(val, token))
+		val = strings.TrimSpace(strings.TrimSuffix(val, token))
+	}
+	return val
+}
 
+// parseAmount converts values like $1,234.50, -$0.30, ($2.75) or 12.50 CAD
+// into floats. accounting-style parentheses are treated as negative amounts
 func parseAmount(amount string) (float64, error) {
-	val := strings.Replace(amount, "$", "", -1)
+	val := strings.TrimSpace(amount)
+	negative := false
+	if strings.HasPrefix(val, "(") && strings.HasSuffix(val, ")") {
+		negative = true
+		val = val[1 : len(val)-1]
+	}
+	val = stripCurrency(val)
+	if strings.HasPrefix(val, "-") {
+		negative = !negative
+		val = val[1:]
+	} else if strings.HasPrefix(val, "+") {
+		val = val[1:]
+	} else if strings.HasSuffix(val, "-") {
+		negative = !negative
+		val = val[:len(val)-1]
+	}
+	val = stripCurrency(val)
+	val = strings.Replace(val, ",", "", -1)
 	if val == "" {
 		return 0.0, nil
 	}
-	return strconv.ParseFloat(val, 64)
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0.0, err
+	}
+	if negative {
+		f = -f
+	}
+	return f, nil
+}
+
+// ParseError describes a usage record which could not be parsed
+type ParseError struct {
+	Row   int    // zero-based record index, excluding the header
+	Field string // name of the UsageRecord field
+	Value string // raw csv value
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("compasscard: row %d: invalid %s %q: %v", e.Row, e.Field, e.Value, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// cleanField trims surrounding whitespace and replaces the non-breaking
+// spaces left over from the html export
+func cleanField(val string) string {
+	return strings.TrimSpace(strings.Replace(val, "\u00a0", " ", -1))
 }
 
-func parseUsageRecord(line []string) (*UsageRecord, error) {
-	t, err := time.Parse(usageRecordLayout, line[0])
+// parseUsageRecord converts a csv row into a UsageRecord, looking up fields
+// by the columns of the header row. Rows missing DateTime, Amount or
+// BalanceDetails are rejected; other missing columns are treated as empty and
+// unknown columns are ignored
+func parseUsageRecord(row int, line []string, columns columnIndex) (*UsageRecord, error) {
+	for _, field := range requiredColumns {
+		if _, ok := columns.value(line, field); !ok {
+			return nil, &ParseError{
+				Row:   row,
+				Field: field,
+				Value: strings.Join(line, ","),
+				Err:   fmt.Errorf("missing column, got %d columns", len(line)),
+			}
+		}
+	}
+	field := func(name string) string {
+		val, _ := columns.value(line, name)
+		return cleanField(val)
+	}
+
+	t, err := parseUsageTime(field("DateTime"))
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{Row: row, Field: "DateTime", Value: field("DateTime"), Err: err}
 	}
-	amount, err := parseAmount(line[4])
+	amount, err := parseAmount(field("Amount"))
 	if err != nil {
-		fmt.Println(line[4])
-		return nil, err
+		return nil, &ParseError{Row: row, Field: "Amount", Value: field("Amount"), Err: err}
 	}
-	balance, err := parseAmount(line[5])
+	balance, err := parseAmount(field("BalanceDetails"))
 	if err != nil {
-		fmt.Println(line[5])
-		return nil, err
+		return nil, &ParseError{Row: row, Field: "BalanceDetails", Value: field("BalanceDetails"), Err: err}
 	}
-	return &UsageRecord{
+	record := &UsageRecord{
 		DateTime:       t,
-		Transaction:    line[1],
-		Product:        line[2],
-		LineItem:       line[3],
-		Amount:         amount,
+		Transaction:    field("Transaction"),
+		Product:        field("Product"),
+		LineItem:       field("LineItem"),
+		RawAmount:      math.Abs(amount),
 		BalanceDetails: balance,
-		OrderDate:      line[6],
-		Payment:        line[7],
-		OrderNumber:    line[8],
-		AuthCode:       line[9],
-		Total:          line[10],
-	}, nil
+		OrderDate:      field("OrderDate"),
+		OrderedAt:      parseOrderDate(field("OrderDate")),
+		Payment:        field("Payment"),
+		OrderNumber:    field("OrderNumber"),
+		AuthCode:       field("AuthCode"),
+		Total:          field("Total"),
+	}
+	record.Amount = signedAmount(*record, amount)
+	return record, nil
+}
+
+// ParseRecord converts a single csv row in the default column order into a UsageRecord
+func ParseRecord(fields []string) (UsageRecord, error) {
+	record, err := parseUsageRecord(0, fields, defaultColumns())
+	if err != nil {
+		return UsageRecord{}, err
+	}
+	return *record, nil
 }
 
 const usageDateLayout = "02/01/2006 15:04:05 PM"
 
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
 // Parse converts a compass card csv response into UsageRecords
 func Parse(raw []byte) ([]UsageRecord, error) {
-	r := csv.NewReader(strings.NewReader(string(raw)))
-	header := true
 	lines := []UsageRecord{}
+	err := ParseFunc(bytes.NewReader(raw), func(record UsageRecord) error {
+		lines = append(lines, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// ParseFunc reads a compass card csv response row by row, calling fn for every
+// record. Parsing stops at the first error returned by fn. A leading UTF-8 BOM
+// is skipped; lines may end in \n or \r\n
+func ParseFunc(r io.Reader, fn func(UsageRecord) error) error {
+	return parseCSV(r, func([]string) {}, fn, nil)
+}
+
+// ParseLenient is like Parse but skips rows which can't be parsed instead of
+// failing, returning their errors alongside the good records
+func ParseLenient(raw []byte) ([]UsageRecord, []ParseError) {
+	lines := []UsageRecord{}
+	skipped := []ParseError{}
+	err := parseCSV(bytes.NewReader(raw), func([]string) {}, func(record UsageRecord) error {
+		lines = append(lines, record)
+		return nil
+	}, func(err *ParseError) {
+		skipped = append(skipped, *err)
+	})
+	if err != nil {
+		// only an unreadable header row aborts a lenient parse
+		skipped = append(skipped, ParseError{Field: "Header", Err: err})
+	}
+	return lines, skipped
+}
+
+// parseCSV passes the header row to header and every following record to fn.
+// If skip is not nil, rows which can't be parsed are passed to it instead of
+// aborting
+func parseCSV(r io.Reader, header func([]string), fn func(UsageRecord) error, skip func(*ParseError)) error {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(bom, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	isHeader := true
+	columns := defaultColumns()
+	row := 0
 	for {
-		line, err := r.Read()
+		line, err := cr.Read()
 		if err == io.EOF {
 			break
 		}
+		var csvErr *csv.ParseError
+		if skip != nil && !isHeader && errors.As(err, &csvErr) {
+			skip(&ParseError{Row: row, Field: "Line", Err: err})
+			row++
+			continue
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		if header {
-			header = !header
+		if isHeader {
+			isHeader = !isHeader
+			header(line)
+			columns = newColumnIndex(line)
 			continue
 		}
 
-		record, err := parseUsageRecord(line)
+		record, err := parseUsageRecord(row, line, columns)
+		var parseErr *ParseError
+		if skip != nil && errors.As(err, &parseErr) {
+			skip(parseErr)
+			row++
+			continue
+		}
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(*record); err != nil {
+			return err
 		}
-		lines = append(lines, *record)
+		row++
 	}
-	return lines, nil
+	return nil
+}
+
+// usageHeader is the header row of the compasscard csv export
+var usageHeader = []string{
+	"DateTime",
+	"Transaction",
+	"Product",
+	"LineItem",
+	"Amount",
+	"BalanceDetails",
+	"OrderDate",
+	"Payment",
+	"OrderNumber",
+	"AuthCode",
+	"Total",
+}
+
+func formatAmount(amount float64) string {
+	if amount < 0 {
+		return fmt.Sprintf("-$%.2f", -amount)
+	}
+	return fmt.Sprintf("$%.2f", amount)
+}
+
+// WriteCSV writes records in the compasscard csv format understood by Parse.
+// Amounts are written with their normalized sign, so parsing the output
+// again yields the same RawAmount and Amount
+func WriteCSV(w io.Writer, records []UsageRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(usageHeader); err != nil {
+		return err
+	}
+	for _, record := range records {
+		err := cw.Write([]string{
+			record.DateTime.In(Vancouver).Format(usageRecordLayout),
+			record.Transaction,
+			record.Product,
+			record.LineItem,
+			formatAmount(record.Amount),
+			formatAmount(record.BalanceDetails),
+			record.OrderDate,
+			record.Payment,
+			record.OrderNumber,
+			record.AuthCode,
+			record.Total,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Card describes a compass card registered with your compasscard account
+type Card struct {
+	SerialNumber string
+	Nickname     string // empty if no nickname is set
+	Type         string // fare category, e.g. Adult or Concession
+	Balance      float64
+
+	AutoReloadEnabled   bool
+	AutoReloadThreshold float64 // balance below which the card is reloaded
+	AutoReloadAmount    float64 // amount loaded on every auto reload
+
+	// Err reports a value of the card which could not be parsed. The value
+	// is left at zero and the card is listed anyway
+	Err error `json:"-"`
 }
 
 // Cards loads all available cards from your compasscard account
 func (s *Session) Cards() ([]string, error) {
-	resp, err := s.client.Get(fmt.Sprintf("%s/ManageCards", endpoint))
+	return s.CardsContext(context.Background())
+}
+
+// CardsContext is like Cards but uses ctx for the underlying request
+func (s *Session) CardsContext(ctx context.Context) ([]string, error) {
+	cards, err := s.CardsDetailedContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	ids := []string{}
+	for _, card := range cards {
+		ids = append(ids, card.SerialNumber)
+	}
+	return ids, nil
+}
 
-	doc, err := html.Parse(resp.Body)
+// CardsDetailed loads all available cards including nickname and balance
+func (s *Session) CardsDetailed() ([]Card, error) {
+	return s.CardsDetailedContext(context.Background())
+}
+
+// CardsDetailedContext is like CardsDetailed but uses ctx for the underlying request
+func (s *Session) CardsDetailedContext(ctx context.Context) ([]Card, error) {
+	doc, err := s.cardsPage(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	cards := parseCards(doc)
 
-	ids := []string{}
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "input" {
-			isCard := false
-			for _, attr := range n.Attr {
-				if attr.Key == "id" && attr.Val == "Content_ManageCard_hfSerialNo" {
-					isCard = true
-					break
-				}
-			}
-			if isCard {
-				for _, attr := range n.Attr {
-					if attr.Key == "value" {
-						ids = append(ids, attr.Val)
-						break
-					}
-				}
-			}
+	// accounts with many cards get a paged listing; follow every page once
+	visited := map[string]bool{"Page$1": true}
+	for {
+		target, argument, ok := nextCardsPage(doc, visited)
+		if !ok {
+			break
+		}
+		visited[argument] = true
+
+		form := formTokens(doc)
+		form.Set("__EVENTTARGET", target)
+		form.Set("__EVENTARGUMENT", argument)
+		doc, err = s.cardsPage(ctx, form)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, parseCards(doc)...)
+	}
+	for _, card := range cards {
+		if card.Err != nil {
+			s.logger.Printf("%v", card.Err)
+		}
+	}
+	return cards, nil
+}
+
+// cardsPage loads the ManageCards page, posting form if it is not nil
+func (s *Session) cardsPage(ctx context.Context, form url.Values) (*html.Node, error) {
+	target := fmt.Sprintf("%s/ManageCards", s.endpoint)
+	var resp *http.Response
+	var err error
+	if form == nil {
+		resp, err = s.get(ctx, target)
+	} else {
+		resp, err = s.postForm(ctx, target, form)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	if redirectedToSignIn(resp) {
+		return nil, ErrSessionExpired
+	}
+
+	doc, err := s.parseHTML("ManageCards", resp)
+	if err != nil {
+		return nil, err
+	}
+	if isSignInPage(doc) && !isSignedIn(doc) {
+		return nil, ErrSessionExpired
+	}
+	return doc, nil
+}
+
+// formTokens collects the ASP.NET form tokens rendered on a page
+func formTokens(doc *html.Node) url.Values {
+	var csrfToken, evntValidation, evntState, evntGenerator string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "input" {
+			captureInput("__CSRFTOKEN", &csrfToken, n)
+			captureInput("__EVENTVALIDATION", &evntValidation, n)
+			captureInput("__VIEWSTATE", &evntState, n)
+			captureInput("__VIEWSTATEGENERATOR", &evntGenerator, n)
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			f(c)
@@ -196,40 +948,479 @@ func (s *Session) Cards() ([]string, error) {
 	}
 	f(doc)
 
-	return ids, nil
+	form := url.Values{}
+	form.Set("__CSRFTOKEN", csrfToken)
+	form.Set("__EVENTVALIDATION", evntValidation)
+	form.Set("__VIEWSTATE", evntState)
+	form.Set("__VIEWSTATEGENERATOR", evntGenerator)
+	return form
+}
+
+// pagerLink matches numbered pager links like __doPostBack('ctl00$Content$gvCards','Page$2')
+var pagerLink = regexp.MustCompile(`__doPostBack\('([^']+)','(Page\$\d+)'\)`)
+
+// nextCardsPage returns the postback target and argument of the first pager
+// link not yet visited
+func nextCardsPage(doc *html.Node, visited map[string]bool) (string, string, bool) {
+	var target, argument string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			href, _ := attrValue(n, "href")
+			if m := pagerLink.FindStringSubmatch(href); m != nil && !visited[m[2]] {
+				target, argument = m[1], m[2]
+			}
+		}
+		for c := n.FirstChild; c != nil && argument == ""; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return target, argument, argument != ""
 }
 
-// Usage looks up a specific compasscard usage
+// Balance returns the current stored value of a card, read from the
+// ManageCards page instead of a usage statement. Card.Err is returned if
+// the card could not be parsed completely
+func (s *Session) Balance(ccsn string) (float64, error) {
+	return s.BalanceContext(context.Background(), ccsn)
+}
+
+// BalanceContext is like Balance but uses ctx for the underlying request
+func (s *Session) BalanceContext(ctx context.Context, ccsn string) (float64, error) {
+	cards, err := s.CardsDetailedContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, card := range cards {
+		if card.SerialNumber == ccsn {
+			return card.Balance, card.Err
+		}
+	}
+	return 0, ErrCardNotFound
+}
+
+// CardExists reports whether ccsn is registered with the signed in account
+func (s *Session) CardExists(ccsn string) (bool, error) {
+	return s.CardExistsContext(context.Background(), ccsn)
+}
+
+// CardExistsContext is like CardExists but uses ctx for the underlying request
+func (s *Session) CardExistsContext(ctx context.Context, ccsn string) (bool, error) {
+	ids, err := s.CardsContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if id == ccsn {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+	return strings.TrimSpace(b.String())
+}
+
+// parseCards walks the ManageCards page in document order. Every serial number
+// input starts a new card; the nickname, type and balance following it belong to it.
+// Unparseable amounts are reported in Card.Err
+func parseCards(doc *html.Node) []Card {
+	cards := []Card{}
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			id, _ := attrValue(n, "id")
+			switch {
+			case n.Data == "input" && id == "Content_ManageCard_hfSerialNo":
+				val, _ := attrValue(n, "value")
+				cards = append(cards, Card{SerialNumber: val})
+			case len(cards) == 0:
+			case n.Data == "input" && id == "Content_ManageCard_txtNickname":
+				cards[len(cards)-1].Nickname, _ = attrValue(n, "value")
+			case id == "Content_ManageCard_lblNickname" || id == "Content_ManageCard_lblCardName":
+				cards[len(cards)-1].Nickname = textContent(n)
+			case id == "Content_ManageCard_lblCardType" || id == "Content_ManageCard_lblFareType":
+				cards[len(cards)-1].Type = textContent(n)
+			case id == "Content_ManageCard_lblBalance":
+				card := &cards[len(cards)-1]
+				balance, err := parseAmount(textContent(n))
+				if err != nil {
+					card.setErr(fmt.Errorf("compasscard: invalid balance for card %s: %w", card.SerialNumber, err))
+				}
+				card.Balance = balance
+			case strings.EqualFold(id, "Content_ManageCard_lblAutoLoadThreshold"):
+				parseAutoReload(&cards[len(cards)-1], &cards[len(cards)-1].AutoReloadThreshold, textContent(n))
+			case strings.EqualFold(id, "Content_ManageCard_lblAutoLoadAmount"):
+				parseAutoReload(&cards[len(cards)-1], &cards[len(cards)-1].AutoReloadAmount, textContent(n))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return cards
+}
+
+// setErr keeps the first parse error of a card
+func (c *Card) setErr(err error) {
+	if c.Err == nil {
+		c.Err = err
+	}
+}
+
+// parseAutoReload stores an auto reload amount of card in val. Cards without
+// auto reload render the labels empty, which leaves the card disabled
+func parseAutoReload(card *Card, val *float64, text string) {
+	if text == "" {
+		return
+	}
+	amount, err := parseAmount(text)
+	if err != nil {
+		card.setErr(fmt.Errorf("compasscard: invalid auto reload for card %s: %w", card.SerialNumber, err))
+		return
+	}
+	*val = amount
+	card.AutoReloadEnabled = true
+}
+
+// AutoReload returns the auto reload configuration of a card, read from the
+// ManageCards page. Cards without auto reload return enabled false and zero
+// amounts. Card.Err is returned if the card could not be parsed completely
+func (s *Session) AutoReload(ccsn string) (threshold, amount float64, enabled bool, err error) {
+	return s.AutoReloadContext(context.Background(), ccsn)
+}
+
+// AutoReloadContext is like AutoReload but uses ctx for the underlying request
+func (s *Session) AutoReloadContext(ctx context.Context, ccsn string) (threshold, amount float64, enabled bool, err error) {
+	cards, err := s.CardsDetailedContext(ctx)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	for _, card := range cards {
+		if card.SerialNumber == ccsn {
+			if card.Err != nil {
+				return 0, 0, false, card.Err
+			}
+			if !card.AutoReloadEnabled {
+				return 0, 0, false, nil
+			}
+			return card.AutoReloadThreshold, card.AutoReloadAmount, true, nil
+		}
+	}
+	return 0, 0, false, ErrCardNotFound
+}
+
+// Usage looks up a specific compasscard usage. The raw statement is returned
+// alongside a ParseError, e.g. to fall back to ParseLenient
 func (s *Session) Usage(ccsn string, opts UsageOptions) ([]UsageRecord, []byte, error) {
+	return s.UsageContext(context.Background(), ccsn, opts)
+}
+
+// UsageContext is like Usage but uses ctx for the underlying request
+func (s *Session) UsageContext(ctx context.Context, ccsn string, opts UsageOptions) ([]UsageRecord, []byte, error) {
+	lines, bs, _, err := s.UsageWithResponseContext(ctx, ccsn, opts)
+	if err != nil {
+		return nil, bs, err
+	}
+	return lines, bs, nil
+}
+
+// UsageWithResponse is like Usage but also returns the http response, e.g. to
+// inspect status, headers and the final request URL. The response body is
+// already drained into the returned bytes. The response is returned alongside
+// errors occurring after it was received, including a *StatusError for a
+// status other than 200
+func (s *Session) UsageWithResponse(ccsn string, opts UsageOptions) ([]UsageRecord, []byte, *http.Response, error) {
+	return s.UsageWithResponseContext(context.Background(), ccsn, opts)
+}
+
+// UsageWithResponseContext is like UsageWithResponse but uses ctx for the underlying request
+func (s *Session) UsageWithResponseContext(ctx context.Context, ccsn string, opts UsageOptions) ([]UsageRecord, []byte, *http.Response, error) {
+	lines, bs, resp, err := s.fetchUsage(ctx, ccsn, opts)
+	if err != nil || opts.Raw {
+		return lines, bs, resp, err
+	}
+
+	// the endpoint occasionally answers with an empty statement while the
+	// session is inconsistent. With retries enabled, try again once. The
+	// session state is left alone so concurrent lookups don't race
+	if len(lines) == 0 && s.attempts > 1 {
+		s.logger.Printf("compasscard: usage for %s returned no records, retrying in %s", ccsn, s.backoff)
+		select {
+		case <-ctx.Done():
+			return nil, bs, resp, ctx.Err()
+		case <-time.After(s.backoff):
+		}
+		lines, bs, resp, err = s.fetchUsage(ctx, ccsn, opts)
+		if err != nil {
+			return lines, bs, resp, err
+		}
+		if len(lines) == 0 {
+			return nil, bs, resp, ErrNoData
+		}
+	}
+	return filterTransactions(lines, opts.TransactionTypes), bs, resp, nil
+}
+
+// fetchUsage downloads and parses a single statement
+func (s *Session) fetchUsage(ctx context.Context, ccsn string, opts UsageOptions) ([]UsageRecord, []byte, *http.Response, error) {
+	// csv statements compress well, ask for gzip explicitly
+	resp, err := s.getWithHeader(ctx, s.BuildUsageURL(ccsn, opts), http.Header{"Accept-Encoding": {"gzip"}})
+	if err != nil {
+		return nil, nil, resp, err
+	}
+	defer closeBody(resp)
+
+	if redirectedToSignIn(resp) {
+		return nil, nil, resp, ErrSessionExpired
+	}
+
+	bs, err := s.readBody("usage", resp)
+	if err != nil {
+		return nil, nil, resp, err
+	}
+	s.logger.Printf("compasscard: usage for %s returned %d bytes", ccsn, len(bs))
+	if isSignInBody(bs) {
+		return nil, bs, resp, ErrSessionExpired
+	}
+	if opts.Raw {
+		return nil, bs, resp, nil
+	}
+
+	lines, err := Parse(bs)
+	if err != nil {
+		return nil, bs, resp, err
+	}
+	return lines, bs, resp, nil
+}
+
+// BuildUsageURL returns the compasscard.ca url Usage fetches for ccsn and
+// opts, e.g. to log or replay a request
+func BuildUsageURL(ccsn string, opts UsageOptions) string {
+	return buildUsageURL(defaultEndpoint, ccsn, opts)
+}
+
+// BuildUsageURL is like the package level BuildUsageURL but honors WithEndpoint
+func (s *Session) BuildUsageURL(ccsn string, opts UsageOptions) string {
+	return buildUsageURL(s.endpoint, ccsn, opts)
+}
+
+func buildUsageURL(endpoint, ccsn string, opts UsageOptions) string {
+	q := usageQuery(ccsn, opts)
+	if !opts.Raw {
+		q.Set("csv", "true")
+	}
+	return fmt.Sprintf("%s/handlers/compasscardusagepdf.ashx?%s", endpoint, q.Encode())
+}
+
+// usageQuery builds the statement query. The range is widened to whole days
+// since the endpoint expects 00:00:00 and 23:59:59 boundaries
+func usageQuery(ccsn string, opts UsageOptions) url.Values {
+	start := startOfDay(opts.StartDate)
+	end := startOfDay(opts.EndDate).AddDate(0, 0, 1).Add(-time.Second)
+
+	reportType := opts.ReportType
+	if reportType == 0 {
+		reportType = 2
+	}
+
 	q := url.Values{}
-	q.Set("type", "2")
-	q.Set("start", opts.StartDate.Format(usageDateLayout))
-	q.Set("end", opts.EndDate.Format(usageDateLayout))
+	q.Set("type", strconv.Itoa(reportType))
+	q.Set("start", start.Format(usageDateLayout))
+	q.Set("end", end.Format(usageDateLayout))
 	q.Set("ccsn", ccsn)
-	q.Set("csv", "true")
-	resp, err := s.client.Get(fmt.Sprintf(
-		"https://www.compasscard.ca/handlers/compasscardusagepdf.ashx?%s",
-		q.Encode(),
+	return q
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// UsagePDF downloads the official usage statement as pdf
+func (s *Session) UsagePDF(ccsn string, opts UsageOptions) ([]byte, error) {
+	return s.UsagePDFContext(context.Background(), ccsn, opts)
+}
+
+// UsagePDFContext is like UsagePDF but uses ctx for the underlying request
+func (s *Session) UsagePDFContext(ctx context.Context, ccsn string, opts UsageOptions) ([]byte, error) {
+	resp, err := s.get(ctx, fmt.Sprintf(
+		"%s/handlers/compasscardusagepdf.ashx?%s",
+		s.endpoint,
+		usageQuery(ccsn, opts).Encode(),
 	),
 	)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer closeBody(resp)
 
-	bs, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
+	if redirectedToSignIn(resp) {
+		return nil, ErrSessionExpired
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pdf") {
+		return nil, fmt.Errorf("compasscard: expected a pdf statement but got %q", ct)
 	}
+	return ioutil.ReadAll(resp.Body)
+}
 
-	lines, err := Parse(bs)
-	if err != nil {
-		return nil, nil, err
+// UsageRange looks up the usage between start and end, issuing one request per
+// calendar month. Records are de-duplicated and sorted by DateTime. Months
+// failing with ErrNoData contribute no records
+func (s *Session) UsageRange(ccsn string, start, end time.Time) ([]UsageRecord, error) {
+	return s.UsageRangeContext(context.Background(), ccsn, start, end)
+}
+
+// UsageRangeContext is like UsageRange but uses ctx for the underlying requests
+func (s *Session) UsageRangeContext(ctx context.Context, ccsn string, start, end time.Time) ([]UsageRecord, error) {
+	records := []UsageRecord{}
+	for _, window := range monthlyWindows(start, end) {
+		lines, _, err := s.UsageContext(ctx, ccsn, window)
+		if errors.Is(err, ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, lines...)
 	}
-	return lines, bs, nil
+	records = Deduplicate(records)
+	SortByDate(records)
+	return records, nil
+}
+
+// UsageYear combines the usage of every month of year, up to the current
+// month for the current year. It is UsageRange from January 1st to the end
+// of the year or now, whichever comes first
+func (s *Session) UsageYear(ccsn string, year int) ([]UsageRecord, error) {
+	return s.UsageYearContext(context.Background(), ccsn, year)
+}
+
+// UsageYearContext is like UsageYear but uses ctx for the underlying requests
+func (s *Session) UsageYearContext(ctx context.Context, ccsn string, year int) ([]UsageRecord, error) {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, Vancouver)
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, Vancouver).Add(-time.Second)
+	if now := time.Now().In(Vancouver); now.Before(end) {
+		end = now
+	}
+	return s.UsageRangeContext(ctx, ccsn, start, end)
+}
+
+// UsageAll looks up the usage of multiple cards in parallel, bounded by
+// WithConcurrency. The first error cancels all outstanding lookups. Cards
+// failing with ErrNoData map to an empty slice
+func (s *Session) UsageAll(ctx context.Context, ccsns []string, opts UsageOptions) (map[string][]UsageRecord, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := s.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	usage := map[string][]UsageRecord{}
+	for _, ccsn := range ccsns {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(ccsn string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			records, _, err := s.UsageContext(ctx, ccsn, opts)
+			if errors.Is(err, ErrNoData) {
+				records, err = []UsageRecord{}, nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			usage[ccsn] = records
+		}(ccsn)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// monthlyWindows splits [start, end] into windows which never cross a month boundary
+func monthlyWindows(start, end time.Time) []UsageOptions {
+	windows := []UsageOptions{}
+	for current := start; !current.After(end); {
+		nextMonth := time.Date(current.Year(), current.Month()+1, 1, 0, 0, 0, 0, current.Location())
+		windowEnd := nextMonth.Add(-time.Second)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+		windows = append(windows, UsageOptions{
+			StartDate: current,
+			EndDate:   windowEnd,
+		})
+		current = nextMonth
+	}
+	return windows
+}
+
+// Login signs in again on an existing session, e.g. after Authenticated
+// reports an expired session. Cookies and options are kept
+func (s *Session) Login(username, password string) error {
+	return s.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext is like Login but uses ctx for the sign in requests
+func (s *Session) LoginContext(ctx context.Context, username, password string) error {
+	if err := s.populateCSRF(ctx); err != nil {
+		return err
+	}
+	return s.login(ctx, username, password)
 }
 
-func (s *Session) login(username, password string) error {
+func (s *Session) login(ctx context.Context, username, password string) error {
 	form := url.Values{}
 	form.Add("__CSRFTOKEN", s.csrfToken)
 	form.Add("__EVENTTARGET", "")
@@ -241,46 +1432,196 @@ func (s *Session) login(username, password string) error {
 	form.Add("__VIEWSTATEGENERATOR", s.evntGenerator)
 	form.Add("__EVENTVALIDATION", s.evntValidation)
 	form.Add("ctl00$Content$btnSignIn", "Sign in")
-	form.Add("ctl00$Content$emailInfo$txtEmail", username)
-	form.Add("ctl00$Content$passwordInfo$txtPassword", password)
+	emailField, passwordField := s.emailField, s.passwordField
+	if emailField == "" {
+		emailField = defaultEmailField
+	}
+	if passwordField == "" {
+		passwordField = defaultPasswordField
+	}
+	form.Set(emailField, username)
+	form.Set(passwordField, password)
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/SignIn", endpoint), strings.NewReader(form.Encode()))
+	resp, err := s.postForm(ctx, fmt.Sprintf("%s/SignIn", s.endpoint), form)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	defer closeBody(resp)
 
-	resp, err := s.client.Do(req)
+	doc, err := s.parseHTML("login", resp)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	switch {
+	case isSignedIn(doc):
+		return nil
+	case requiresCaptcha(doc):
+		return ErrCaptchaRequired
+	case isAccountLocked(doc):
+		return ErrAccountLocked
+	default:
+		return ErrInvalidCredentials
+	}
+}
 
-	return nil
+// captchaMessages are shown by compasscard.ca when a sign in has to pass a
+// captcha. The recaptcha widget alone is rendered on every sign in page
+var captchaMessages = []string{
+	"captcha",
+	"not a robot",
+}
+
+// requiresCaptcha reports whether a page asks to solve a captcha challenge
+func requiresCaptcha(doc *html.Node) bool {
+	return containsMessage(doc, captchaMessages)
 }
 
-// TODO add SignOut call to session
+// lockoutMessages are shown by compasscard.ca after too many failed sign ins
+var lockoutMessages = []string{
+	"account has been locked",
+	"account is locked",
+	"temporarily locked",
+}
+
+// isAccountLocked reports whether a page contains a lockout message
+func isAccountLocked(doc *html.Node) bool {
+	return containsMessage(doc, lockoutMessages)
+}
+
+// containsMessage reports whether the visible text of a page contains one of
+// messages, ignoring case. Scripts and styles are skipped
+func containsMessage(doc *html.Node, messages []string) bool {
+	var b strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	text := strings.ToLower(b.String())
+	for _, msg := range messages {
+		if strings.Contains(text, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSignedIn reports whether a page was rendered for an authenticated user,
+// by looking for the sign out control or the card serial number inputs
+func isSignedIn(doc *html.Node) bool {
+	signedIn := false
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, attr := range n.Attr {
+				if (attr.Key == "id" || attr.Key == "name" || attr.Key == "href") && strings.Contains(attr.Val, "btnSignOut") {
+					signedIn = true
+				}
+				if attr.Key == "id" && attr.Val == "Content_ManageCard_hfSerialNo" {
+					signedIn = true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil && !signedIn; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return signedIn
+}
+
+// Authenticated reports whether the session is still signed in to compasscard.ca
+func (s *Session) Authenticated() (bool, error) {
+	return s.AuthenticatedContext(context.Background())
+}
+
+// AuthenticatedContext is like Authenticated but uses ctx for the underlying request
+func (s *Session) AuthenticatedContext(ctx context.Context) (bool, error) {
+	resp, err := s.get(ctx, fmt.Sprintf("%s/ManageCards", s.endpoint))
+	if err != nil {
+		return false, err
+	}
+	defer closeBody(resp)
+	return !redirectedToSignIn(resp), nil
+}
+
+// Signout ends the session and verifies compasscard.ca shows the sign in form again
 func (s *Session) Signout() error {
-	form := url.Values{}
-	form.Add("__CSRFTOKEN", s.csrfToken)
-	form.Add("__VIEWSTATE", s.evntState)
-	form.Add("__EVENTTARGET", "ctl00$btnSignOut")
-	form.Add("__EVENTARGUMENT", "")
-	form.Add("__VIEWSTATEGENERATOR", s.evntGenerator)
-	form.Add("__EVENTVALIDATION", s.evntValidation)
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/ManageCards", endpoint), strings.NewReader(form.Encode()))
+	return s.SignoutContext(context.Background())
+}
+
+// SignoutContext is like Signout but uses ctx for the underlying request
+func (s *Session) SignoutContext(ctx context.Context) error {
+	resp, err := s.postAction(ctx, "ManageCards", func() url.Values {
+		form := url.Values{}
+		form.Add("__CSRFTOKEN", s.csrfToken)
+		form.Add("__VIEWSTATE", s.evntState)
+		form.Add("__EVENTTARGET", "ctl00$btnSignOut")
+		form.Add("__EVENTARGUMENT", "")
+		form.Add("__VIEWSTATEGENERATOR", s.evntGenerator)
+		form.Add("__EVENTVALIDATION", s.evntValidation)
+		return form
+	})
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := s.client.Do(req)
+	defer closeBody(resp)
+
+	doc, err := s.parseHTML("signout", resp)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	if isSignedIn(doc) || !isSignInPage(doc) {
+		return ErrSignoutFailed
+	}
+	s.csrfToken = ""
+	s.evntValidation = ""
+	s.evntState = ""
+	s.evntGenerator = ""
 	return nil
 }
 
+// Close signs out and releases the http client. Calling Close on a session
+// which is already signed out or closed is not an error. After Close all
+// methods return ErrClosed. Close must not be called concurrently with
+// other methods
+func (s *Session) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	err := s.Signout()
+	if errors.Is(err, ErrSessionExpired) {
+		err = nil
+	}
+	s.client = nil
+	return err
+}
+
+// isSignInPage reports whether a page contains the sign in form
+func isSignInPage(doc *html.Node) bool {
+	found := false
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "input" {
+			name, _ := attrValue(n, "name")
+			found = found || name == "ctl00$txtSignInEmail" || name == "ctl00$Content$emailInfo$txtEmail"
+		}
+		for c := n.FirstChild; c != nil && !found; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return found
+}
+
 type ClientOption interface {
 	Apply(*Session)
 }
@@ -297,22 +1638,188 @@ func WithCookieJar(jar *cookiejar.Jar) ClientOption {
 	})
 }
 
-func New(username, password string, options ...ClientOption) (*Session, error) {
+// WithHTTPClient replaces the http.Client used by the session. The client is
+// copied; if it has no cookie jar the session's jar is kept
+func WithHTTPClient(client *http.Client) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		c := *client
+		if c.Jar == nil {
+			c.Jar = s.client.Jar
+		}
+		s.client = &c
+	})
+}
+
+// WithTimeout limits the duration of every request made by the session.
+// A zero duration means no timeout
+func WithTimeout(d time.Duration) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.client.Timeout = d
+	})
+}
+
+// WithLogger sets a logger receiving debug output for every request
+func WithLogger(logger Logger) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.logger = logger
+	})
+}
+
+// WithRetry retries GET requests failing with a network error or a 5xx status
+// up to attempts times in total, waiting backoff before the first retry and
+// doubling the wait for every following one
+func WithRetry(attempts int, backoff time.Duration) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.attempts = attempts
+		s.backoff = backoff
+	})
+}
+
+// WithEndpoint points the session at a different compasscard.ca host,
+// e.g. a staging or mock server
+func WithEndpoint(endpoint string) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.endpoint = strings.TrimSuffix(endpoint, "/")
+	})
+}
+
+// WithConcurrency limits the number of parallel requests issued by UsageAll.
+// Defaults to 4
+func WithConcurrency(n int) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.concurrency = n
+	})
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+// Defaults to a desktop browser
+func WithUserAgent(userAgent string) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.userAgent = userAgent
+	})
+}
+
+// WithoutLogin makes New skip signing in, e.g. to reuse cookies restored via
+// LoadCookies or WithCookieJar. The form tokens are still fetched. The caller
+// is responsible for providing a cookie jar holding a valid session
+func WithoutLogin() ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.skipLogin = true
+	})
+}
+
+// WithRateLimit allows at most rps requests per second, across all methods
+// of the session. Waiting for the limiter respects context cancellation
+func WithRateLimit(rps float64) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.limiter = rate.NewLimiter(rate.Limit(rps), 1)
+	})
+}
+
+// WithTransport sets the http.RoundTripper used for requests, e.g. for a
+// proxy or custom TLS configuration. The cookie jar is left untouched
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.client.Transport = transport
+	})
+}
+
+// WithRedirectPolicy sets the http.Client CheckRedirect func, e.g. to observe
+// redirects. By default all redirects are followed. ErrSessionExpired is
+// detected from the final url being SignIn, so a policy returning
+// http.ErrUseLastResponse turns those redirects into a *StatusError instead
+func WithRedirectPolicy(fn func(req *http.Request, via []*http.Request) error) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.client.CheckRedirect = fn
+	})
+}
+
+// WithTransportTuning configures the connection pool of the http.Transport,
+// keeping TLS and HTTP/2 defaults and the cookie jar. maxConnsPerHost should be
+// at least the WithConcurrency limit, otherwise UsageAll requests queue for a
+// connection; zero means no limit. Apply it after WithTransport to tune a
+// custom *http.Transport. Any other custom http.RoundTripper is left untouched
+// and reported to the logger, so apply WithLogger first
+func WithTransportTuning(maxIdleConns, maxConnsPerHost int) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		base := http.DefaultTransport.(*http.Transport)
+		if s.client.Transport != nil {
+			custom, ok := s.client.Transport.(*http.Transport)
+			if !ok {
+				s.logger.Printf("compasscard: WithTransportTuning ignored, transport is a %T, not an *http.Transport", s.client.Transport)
+				return
+			}
+			base = custom
+		}
+		transport := base.Clone()
+		transport.ForceAttemptHTTP2 = true
+		transport.MaxIdleConns = maxIdleConns
+		transport.MaxIdleConnsPerHost = maxConnsPerHost
+		transport.MaxConnsPerHost = maxConnsPerHost
+		s.client.Transport = transport
+	})
+}
+
+// WithResponseRecorder calls fn with the raw body of every response the
+// session parses. name is one of SignIn, ManageCards, login, signout or usage
+func WithResponseRecorder(fn func(name string, body []byte)) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.recorder = fn
+	})
+}
+
+// WithClientTrace attaches the trace returned by fn to every outbound request,
+// e.g. to time DNS lookups, connects, TLS handshakes and the first byte
+func WithClientTrace(fn func() *httptrace.ClientTrace) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.trace = fn
+	})
+}
+
+// WithDebugHTTP writes every request and response, including headers and
+// bodies, to w. Form values named like a password and the SignIn password
+// input are redacted
+func WithDebugHTTP(w io.Writer) ClientOption {
+	return ClientOptionFunc(func(s *Session) {
+		s.debug = w
+	})
+}
+
+// newSession creates a Session with a fresh cookie jar and applies options
+func newSession(options []ClientOption) *Session {
 	jar, _ := cookiejar.New(nil)
 	client := &http.Client{
 		Jar: jar,
 	}
 
 	s := &Session{
-		client: client,
+		client:    client,
+		logger:    noopLogger{},
+		endpoint:  defaultEndpoint,
+		userAgent: defaultUserAgent,
+
+		concurrency: 4,
 	}
 	for _, opt := range options {
 		opt.Apply(s)
 	}
-	if err := s.populateCSRF(); err != nil {
-		return nil, err
+	return s
+}
+
+func New(username, password string, options ...ClientOption) (*Session, error) {
+	return NewContext(context.Background(), username, password, options...)
+}
+
+// NewContext is like New but uses ctx for the sign in requests
+func NewContext(ctx context.Context, username, password string, options ...ClientOption) (*Session, error) {
+	s := newSession(options)
+	if s.skipLogin {
+		if err := s.populateCSRF(ctx); err != nil {
+			return nil, err
+		}
+		return s, nil
 	}
-	if err := s.login(username, password); err != nil {
+	if err := s.LoginContext(ctx, username, password); err != nil {
 		return nil, err
 	}
 	return s, nil
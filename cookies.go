@@ -0,0 +1,59 @@
+package compasscard
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var errNoCookieJar = errors.New("compasscard: session has no cookie jar")
+
+// SaveCookies writes the session cookies for compasscard.ca to w as JSON
+func (s *Session) SaveCookies(w io.Writer) error {
+	if s.client == nil {
+		return ErrClosed
+	}
+	if s.client.Jar == nil {
+		return errNoCookieJar
+	}
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(s.client.Jar.Cookies(u))
+}
+
+// LoadCookies restores cookies previously written by SaveCookies
+func (s *Session) LoadCookies(r io.Reader) error {
+	if s.client == nil {
+		return ErrClosed
+	}
+	if s.client.Jar == nil {
+		return errNoCookieJar
+	}
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return err
+	}
+	cookies := []*http.Cookie{}
+	if err := json.NewDecoder(r).Decode(&cookies); err != nil {
+		return err
+	}
+	s.client.Jar.SetCookies(u, cookies)
+	return nil
+}
+
+// Cookies returns the session cookies for compasscard.ca, or nil if the
+// session has no cookie jar
+func (s *Session) Cookies() []*http.Cookie {
+	if s.client == nil || s.client.Jar == nil {
+		return nil
+	}
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil
+	}
+	return s.client.Jar.Cookies(u)
+}
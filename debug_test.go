@@ -0,0 +1,26 @@
+package compasscard
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHTTPRedactsPassword(t *testing.T) {
+	for _, field := range []string{defaultPasswordField, "ctl00$Content$txtPin"} {
+		srv := httptest.NewServer(&fakeSite{passwordField: field})
+		var buf bytes.Buffer
+		_, err := New("user@example.com", "secret", WithEndpoint(srv.URL), WithDebugHTTP(&buf))
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		if strings.Contains(buf.String(), "secret") {
+			t.Errorf("%s: password leaked into debug output:\n%s", field, buf.String())
+		}
+		if !strings.Contains(buf.String(), "REDACTED") {
+			t.Errorf("%s: expected a redacted value", field)
+		}
+	}
+}
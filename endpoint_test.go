@@ -0,0 +1,48 @@
+package compasscard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWithEndpoint(t *testing.T) {
+	site := &fakeSite{cards: []string{"1234"}, usage: fixture(t, "usage.csv")}
+	paths := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+		if req.URL.Query().Get("csv") == "" && req.URL.Path == "/handlers/compasscardusagepdf.ashx" {
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.4"))
+			return
+		}
+		site.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	s, err := New("user@example.com", "secret", WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Cards(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Usage("1234", january2018); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UsagePDF("1234", january2018); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /SignIn",
+		"POST /SignIn",
+		"GET /ManageCards",
+		"GET /handlers/compasscardusagepdf.ashx",
+		"GET /handlers/compasscardusagepdf.ashx",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected requests %q, got %q", want, paths)
+	}
+}
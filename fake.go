@@ -0,0 +1,127 @@
+package compasscard
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+)
+
+// UsageFetcher is the read-only part of a Session. Depend on it instead of
+// *Session to substitute a FakeSession in tests
+type UsageFetcher interface {
+	CardsContext(ctx context.Context) ([]string, error)
+	CardExistsContext(ctx context.Context, ccsn string) (bool, error)
+	UsageContext(ctx context.Context, ccsn string, opts UsageOptions) ([]UsageRecord, []byte, error)
+	UsageRangeContext(ctx context.Context, ccsn string, start, end time.Time) ([]UsageRecord, error)
+	UsageAll(ctx context.Context, ccsns []string, opts UsageOptions) (map[string][]UsageRecord, error)
+	UsagePDFContext(ctx context.Context, ccsn string, opts UsageOptions) ([]byte, error)
+	Close() error
+}
+
+var (
+	_ UsageFetcher = (*Session)(nil)
+	_ UsageFetcher = (*FakeSession)(nil)
+)
+
+// FakeSession is a UsageFetcher serving preloaded records without network
+// access. Cards not in Records are reported as ErrCardNotFound
+type FakeSession struct {
+	Records map[string][]UsageRecord // usage by ccsn
+	PDFs    map[string][]byte        // statements by ccsn, ErrNoData if missing
+	Err     error                    // returned by every method when set
+}
+
+// CardsContext returns the ccsns of Records in ascending order
+func (f *FakeSession) CardsContext(ctx context.Context) ([]string, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	cards := []string{}
+	for ccsn := range f.Records {
+		cards = append(cards, ccsn)
+	}
+	sort.Strings(cards)
+	return cards, nil
+}
+
+// CardExistsContext reports whether Records holds ccsn
+func (f *FakeSession) CardExistsContext(ctx context.Context, ccsn string) (bool, error) {
+	if f.Err != nil {
+		return false, f.Err
+	}
+	_, ok := f.Records[ccsn]
+	return ok, nil
+}
+
+// UsageContext returns the records of ccsn on the days between
+// opts.StartDate and opts.EndDate, filtered like Session.UsageContext.
+// The raw csv is generated with WriteCSV
+func (f *FakeSession) UsageContext(ctx context.Context, ccsn string, opts UsageOptions) ([]UsageRecord, []byte, error) {
+	start := startOfDay(opts.StartDate)
+	end := startOfDay(opts.EndDate).AddDate(0, 0, 1).Add(-time.Second)
+	records, err := f.between(ccsn, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		return nil, nil, err
+	}
+	return filterTransactions(records, opts.TransactionTypes), buf.Bytes(), nil
+}
+
+// UsageRangeContext returns the records of ccsn between start and end
+func (f *FakeSession) UsageRangeContext(ctx context.Context, ccsn string, start, end time.Time) ([]UsageRecord, error) {
+	return f.between(ccsn, start, end)
+}
+
+// UsageAll calls UsageContext for every ccsn
+func (f *FakeSession) UsageAll(ctx context.Context, ccsns []string, opts UsageOptions) (map[string][]UsageRecord, error) {
+	usage := map[string][]UsageRecord{}
+	for _, ccsn := range ccsns {
+		records, _, err := f.UsageContext(ctx, ccsn, opts)
+		if err != nil {
+			return nil, err
+		}
+		usage[ccsn] = records
+	}
+	return usage, nil
+}
+
+// UsagePDFContext returns the preloaded statement of ccsn regardless of opts
+func (f *FakeSession) UsagePDFContext(ctx context.Context, ccsn string, opts UsageOptions) ([]byte, error) {
+	if _, err := f.between(ccsn, time.Time{}, time.Time{}); err != nil {
+		return nil, err
+	}
+	pdf, ok := f.PDFs[ccsn]
+	if !ok {
+		return nil, ErrNoData
+	}
+	return pdf, nil
+}
+
+// Close is a no-op, a FakeSession stays usable
+func (f *FakeSession) Close() error {
+	return nil
+}
+
+// between returns the records of ccsn within [start, end] sorted by date.
+// A zero end matches everything
+func (f *FakeSession) between(ccsn string, start, end time.Time) ([]UsageRecord, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	all, ok := f.Records[ccsn]
+	if !ok {
+		return nil, ErrCardNotFound
+	}
+	records := []UsageRecord{}
+	for _, record := range all {
+		if end.IsZero() || (!record.DateTime.Before(start) && !record.DateTime.After(end)) {
+			records = append(records, record)
+		}
+	}
+	SortByDate(records)
+	return records, nil
+}
@@ -0,0 +1,66 @@
+package compasscard
+
+import (
+	"strings"
+	"time"
+)
+
+// Journey is a trip reconstructed from a tap in and the following tap out.
+// Either TapIn or TapOut is nil if the matching tap is missing
+type Journey struct {
+	TapIn, TapOut *UsageRecord
+	Fare          float64 // amount charged for the trip, positive when money was spent
+	Duration      time.Duration
+}
+
+func isTapIn(r UsageRecord) bool {
+	return strings.HasPrefix(strings.ToLower(r.Transaction), "tap in")
+}
+
+func isTapOut(r UsageRecord) bool {
+	return strings.HasPrefix(strings.ToLower(r.Transaction), "tap out")
+}
+
+// Journeys pairs tap in and tap out records of a single card chronologically.
+// A tap in followed by another tap in yields a journey without TapOut; a tap
+// out without preceding tap in yields a journey without TapIn. Other records
+// are ignored
+func Journeys(records []UsageRecord) []Journey {
+	sorted := make([]UsageRecord, len(records))
+	copy(sorted, records)
+	SortByDate(sorted)
+
+	journeys := []Journey{}
+	var pending *UsageRecord
+	for i := range sorted {
+		record := &sorted[i]
+		switch {
+		case isTapIn(*record):
+			if pending != nil {
+				journeys = append(journeys, newJourney(pending, nil))
+			}
+			pending = record
+		case isTapOut(*record):
+			journeys = append(journeys, newJourney(pending, record))
+			pending = nil
+		}
+	}
+	if pending != nil {
+		journeys = append(journeys, newJourney(pending, nil))
+	}
+	return journeys
+}
+
+func newJourney(tapIn, tapOut *UsageRecord) Journey {
+	j := Journey{TapIn: tapIn, TapOut: tapOut}
+	if tapIn != nil {
+		j.Fare -= tapIn.Amount
+	}
+	if tapOut != nil {
+		j.Fare -= tapOut.Amount
+	}
+	if tapIn != nil && tapOut != nil {
+		j.Duration = tapOut.DateTime.Sub(tapIn.DateTime)
+	}
+	return j
+}
@@ -0,0 +1,89 @@
+package compasscard
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// usageRecordJSON documents the JSON representation of a UsageRecord.
+// date is formatted as RFC 3339 in Vancouver local time
+type usageRecordJSON struct {
+	Date        string  `json:"date"`
+	Transaction string  `json:"transaction"`
+	Product     string  `json:"product"`
+	LineItem    string  `json:"line_item"`
+	Amount      float64 `json:"amount"`
+	RawAmount   float64 `json:"raw_amount"`
+	Balance     float64 `json:"balance"`
+	OrderDate   string  `json:"order_date"`
+	OrderedAt   string  `json:"ordered_at,omitempty"`
+	Payment     string  `json:"payment"`
+	OrderNumber string  `json:"order_number"`
+	AuthCode    string  `json:"auth_code"`
+	Total       string  `json:"total"`
+}
+
+// orderedAt formats OrderedAt like date, or empty if it is unknown
+func orderedAt(r UsageRecord) string {
+	if r.OrderedAt.IsZero() {
+		return ""
+	}
+	return r.OrderedAt.In(Vancouver).Format(time.RFC3339)
+}
+
+// MarshalJSON encodes the record with stable snake_case keys
+func (r UsageRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(usageRecordJSON{
+		Date:        r.DateTime.In(Vancouver).Format(time.RFC3339),
+		Transaction: r.Transaction,
+		Product:     r.Product,
+		LineItem:    r.LineItem,
+		Amount:      r.Amount,
+		RawAmount:   r.RawAmount,
+		Balance:     r.BalanceDetails,
+		OrderDate:   r.OrderDate,
+		OrderedAt:   orderedAt(r),
+		Payment:     r.Payment,
+		OrderNumber: r.OrderNumber,
+		AuthCode:    r.AuthCode,
+		Total:       r.Total,
+	})
+}
+
+// UnmarshalJSON decodes the snake_case keys written by MarshalJSON. Dates are
+// converted to Vancouver local time
+func (r *UsageRecord) UnmarshalJSON(data []byte) error {
+	var v usageRecordJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	date, err := time.Parse(time.RFC3339, v.Date)
+	if err != nil {
+		return fmt.Errorf("compasscard: invalid date %q: %w", v.Date, err)
+	}
+	var ordered time.Time
+	if v.OrderedAt != "" {
+		ordered, err = time.Parse(time.RFC3339, v.OrderedAt)
+		if err != nil {
+			return fmt.Errorf("compasscard: invalid ordered_at %q: %w", v.OrderedAt, err)
+		}
+		ordered = ordered.In(Vancouver)
+	}
+	*r = UsageRecord{
+		DateTime:       date.In(Vancouver),
+		Transaction:    v.Transaction,
+		Product:        v.Product,
+		LineItem:       v.LineItem,
+		Amount:         v.Amount,
+		RawAmount:      v.RawAmount,
+		BalanceDetails: v.Balance,
+		OrderDate:      v.OrderDate,
+		OrderedAt:      ordered,
+		Payment:        v.Payment,
+		OrderNumber:    v.OrderNumber,
+		AuthCode:       v.AuthCode,
+		Total:          v.Total,
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package compasscard
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsageRecordJSONRoundTrip(t *testing.T) {
+	records := []UsageRecord{
+		{
+			DateTime:       time.Date(2018, time.January, 2, 8, 15, 0, 0, Vancouver),
+			Transaction:    "Tap in at Main St",
+			Product:        "Stored Value",
+			Amount:         -2.10,
+			RawAmount:      2.10,
+			BalanceDetails: 7.90,
+		},
+		{
+			DateTime:       time.Date(2018, time.January, 3, 17, 0, 0, 0, Vancouver),
+			Transaction:    "Purchase",
+			Product:        "Monthly Pass",
+			LineItem:       "1 Zone Adult",
+			Amount:         -98.00,
+			RawAmount:      98.00,
+			BalanceDetails: 7.90,
+			OrderDate:      "Jan-03-2018 05:00 PM",
+			OrderedAt:      time.Date(2018, time.January, 3, 17, 0, 0, 0, Vancouver),
+			Payment:        "Visa",
+			OrderNumber:    "12345",
+			AuthCode:       "A1B2C3",
+			Total:          "$98.00",
+		},
+	}
+	bs, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []UsageRecord
+	if err := json.Unmarshal(bs, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, records) {
+		t.Errorf("expected %+v, got %+v", records, decoded)
+	}
+
+	var record UsageRecord
+	if err := json.Unmarshal([]byte(`{"date":"Jan-02-2018"}`), &record); err == nil {
+		t.Error("expected an invalid date to fail")
+	}
+}
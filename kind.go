@@ -0,0 +1,88 @@
+package compasscard
+
+import (
+	"math"
+	"strings"
+)
+
+// Kind classifies a UsageRecord
+type Kind int
+
+const (
+	// Unknown is used for transactions not matching any other kind
+	Unknown Kind = iota
+	// Tap is a tap in, tap out or transfer
+	Tap
+	// Reload adds stored value, e.g. Loaded or AutoLoad
+	Reload
+	// Purchase buys a product such as a monthly pass
+	Purchase
+	// Adjustment corrects a previous charge, e.g. a fare adjustment or refund
+	Adjustment
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Tap:
+		return "Tap"
+	case Reload:
+		return "Reload"
+	case Purchase:
+		return "Purchase"
+	case Adjustment:
+		return "Adjustment"
+	default:
+		return "Unknown"
+	}
+}
+
+// Classify determines the Kind of a record from its Transaction and Product:
+//
+//	Transaction "Tap in…", "Tap out…", "Transfer…"           Tap
+//	Transaction containing "adjust", "refund" or "correction" Adjustment
+//	Transaction containing "load" (Loaded, AutoLoad)          Reload
+//	Transaction containing "purchase", Product "…Pass"        Purchase
+//
+// Anything else is Unknown
+func Classify(r UsageRecord) Kind {
+	transaction := strings.ToLower(r.Transaction)
+	product := strings.ToLower(r.Product)
+	switch {
+	case isTapIn(r) || isTapOut(r) || strings.HasPrefix(transaction, "transfer"):
+		return Tap
+	case strings.Contains(transaction, "adjust") || strings.Contains(transaction, "refund") || strings.Contains(transaction, "correction"):
+		return Adjustment
+	case strings.Contains(transaction, "load"):
+		return Reload
+	case strings.Contains(transaction, "purchase") || strings.Contains(product, "pass"):
+		return Purchase
+	default:
+		return Unknown
+	}
+}
+
+// signedAmount normalizes the sign of a parsed amount by the Kind of r:
+// taps and purchases are spend and become negative, reloads and adjustments
+// such as refunds are credits and become positive. Unknown records keep the
+// printed sign
+func signedAmount(r UsageRecord, amount float64) float64 {
+	switch Classify(r) {
+	case Tap, Purchase:
+		return -math.Abs(amount)
+	case Reload, Adjustment:
+		return math.Abs(amount)
+	default:
+		return amount
+	}
+}
+
+// Reloads returns the records classified as Reload
+func Reloads(records []UsageRecord) []UsageRecord {
+	reloads := []UsageRecord{}
+	for _, record := range records {
+		if Classify(record) == Reload {
+			reloads = append(reloads, record)
+		}
+	}
+	return reloads
+}
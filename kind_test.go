@@ -0,0 +1,80 @@
+package compasscard
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// signedStatement is balance consistent: 10.00 - 2.75 + 0.00 + 1.25 + 5.00 + 20.00.
+// The tap in and the refund are printed without a sign
+const signedStatement = `DateTime,Transaction,Product,LineItem,Amount,BalanceDetails,OrderDate,Payment,OrderNumber,AuthCode,Total
+Jan-30-2018 08:00 AM,Tap in at Main St,Stored Value,,$2.75,$7.25,,,,,
+Jan-30-2018 08:20 AM,Tap out at Waterfront Stn,Stored Value,,$0.00,$7.25,,,,,
+Jan-30-2018 09:00 AM,Fare Adjustment,Stored Value,,+$1.25,$8.50,,,,,
+Jan-30-2018 10:00 AM,Refund,Stored Value,,($5.00),$13.50,,,,,
+Jan-30-2018 11:00 AM,Loaded,Stored Value,,$20.00,$33.50,,,,,
+`
+
+func TestAmountSign(t *testing.T) {
+	tests := []struct {
+		transaction, product, amount string
+		want, raw                    float64
+	}{
+		{"Tap in at Main St", "Stored Value", "-$2.75", -2.75, 2.75},
+		{"Tap in at Main St", "Stored Value", "$2.75", -2.75, 2.75},
+		{"Tap out at Main St", "Stored Value", "$0.00", 0, 0},
+		{"Fare Adjustment", "Stored Value", "-$1.25", 1.25, 1.25},
+		{"Refund", "Stored Value", "$5.00", 5, 5},
+		{"Refund", "Stored Value", "($5.00)", 5, 5},
+		{"Refund", "Stored Value", "+$5.00", 5, 5},
+		{"Purchase", "Monthly Pass 1 Zone", "$98.00", -98, 98},
+		{"Purchase", "Monthly Pass 1 Zone", "-$98.00", -98, 98},
+		{"Loaded", "Stored Value", "$20.00", 20, 20},
+		{"Card Replacement", "Stored Value", "-$6.00", -6, 6},
+	}
+	for _, test := range tests {
+		record, err := ParseRecord([]string{"Jan-30-2018 08:00 AM", test.transaction, test.product, "", test.amount, "$0.00", "", "", "", "", ""})
+		if err != nil {
+			t.Fatalf("%s %s: %v", test.transaction, test.amount, err)
+		}
+		if record.Amount != test.want || record.RawAmount != test.raw {
+			t.Errorf("%s %s: got Amount %v RawAmount %v, want %v and %v", test.transaction, test.amount, record.Amount, record.RawAmount, test.want, test.raw)
+		}
+	}
+}
+
+func TestSignedStatementValidates(t *testing.T) {
+	records, err := Parse([]byte(signedStatement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(records); len(errs) != 0 {
+		t.Errorf("expected a consistent statement, got %v", errs)
+	}
+
+	journeys := Journeys(records)
+	if len(journeys) != 1 || math.Abs(journeys[0].Fare-2.75) > centEpsilon {
+		t.Errorf("expected a single journey with a 2.75 fare, got %+v", journeys)
+	}
+}
+
+func TestWriteCSVKeepsRawAmount(t *testing.T) {
+	statement := signedStatement + "Jan-30-2018 12:00 PM,Purchase,Monthly Pass 1 Zone,,$98.00,$33.50,,,,,\n"
+	records, err := Parse([]byte(statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, again) {
+		t.Errorf("round trip changed records:\n%+v\n%+v", records, again)
+	}
+}
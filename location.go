@@ -0,0 +1,48 @@
+package compasscard
+
+import "strings"
+
+// Transit modes detected by Location
+const (
+	ModeBus              = "Bus"
+	ModeSkyTrain         = "SkyTrain"
+	ModeSeaBus           = "SeaBus"
+	ModeWestCoastExpress = "WestCoastExpress"
+)
+
+// Location extracts the transit mode and the station or route of a record,
+// e.g. ("SkyTrain", "Waterfront Stn") for "Tap in at Waterfront Stn" or
+// ("Bus", "Bus Stop 60980"). The name is taken from the Transaction after
+// " at ", falling back to LineItem. mode is empty if it can't be determined
+func Location(r UsageRecord) (mode, name string) {
+	name = r.LineItem
+	if i := strings.Index(strings.ToLower(r.Transaction), " at "); i >= 0 {
+		name = strings.TrimSpace(r.Transaction[i+len(" at "):])
+	}
+	return detectMode(name + " " + r.Product), name
+}
+
+func detectMode(text string) string {
+	text = strings.ToLower(text)
+	words := strings.Fields(text)
+	hasWord := func(word string) bool {
+		for _, w := range words {
+			if strings.Trim(w, ".,#") == word {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case strings.Contains(text, "west coast express") || hasWord("wce"):
+		return ModeWestCoastExpress
+	case strings.Contains(text, "seabus") || strings.Contains(text, "lonsdale quay"):
+		return ModeSeaBus
+	case hasWord("bus"):
+		return ModeBus
+	case hasWord("stn") || hasWord("station") || strings.Contains(text, "skytrain"):
+		return ModeSkyTrain
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,49 @@
+package compasscard
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestIsSignedIn(t *testing.T) {
+	doc, err := html.Parse(bytes.NewReader(fixture(t, "signin-invalid.html")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isSignedIn(doc) {
+		t.Errorf("expected the bad password page not to be signed in")
+	}
+
+	doc, err = html.Parse(strings.NewReader(`<a id="ctl00_btnSignOut" href="javascript:__doPostBack('ctl00$btnSignOut','')">Sign out</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSignedIn(doc) {
+		t.Errorf("expected a page with the sign out control to be signed in")
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	tests := map[string]error{
+		"signin-invalid.html": ErrInvalidCredentials,
+		"signin-captcha.html": ErrCaptchaRequired,
+		"signin-locked.html":  ErrAccountLocked,
+	}
+	for name, want := range tests {
+		page := fixture(t, name)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write(page)
+		}))
+		_, err := New("user@example.com", "secret", WithEndpoint(srv.URL))
+		srv.Close()
+		if !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package compasscard_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/nicolai86/compasscard"
+)
+
+// TestOffline only uses the network-free subset of the package
+func TestOffline(t *testing.T) {
+	record, err := compasscard.ParseRecord([]string{"Jan-30-2018 09:15 AM", "Tap in at Main St", "Stored Value", "", "-$2.10", "$17.90", "", "", "", "", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Amount != -2.10 || record.BalanceDetails != 17.90 {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	var buf bytes.Buffer
+	if err := compasscard.WriteCSV(&buf, []compasscard.UsageRecord{record}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := compasscard.Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !reflect.DeepEqual(records[0], record) {
+		t.Errorf("expected %+v, got %+v", record, records)
+	}
+}
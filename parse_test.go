@@ -0,0 +1,203 @@
+package compasscard
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const csvHeader = "DateTime,Transaction,Product,LineItem,Amount,BalanceDetails,OrderDate,Payment,OrderNumber,AuthCode,Total\n"
+
+func TestUsageRecordLayout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"Jan-30-2018 09:15 AM", time.Date(2018, time.January, 30, 9, 15, 0, 0, Vancouver)},
+		{"Jan-30-2018 06:08 PM", time.Date(2018, time.January, 30, 18, 8, 0, 0, Vancouver)},
+	}
+	for _, test := range tests {
+		records, err := Parse([]byte(csvHeader + test.value + ",Tap in at Main St,Stored Value,,-$2.10,$17.90,,,,,\n"))
+		if err != nil {
+			t.Fatalf("%q: %v", test.value, err)
+		}
+		if !records[0].DateTime.Equal(test.want) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.want, records[0].DateTime)
+		}
+		if formatted := records[0].DateTime.Format(usageRecordLayout); formatted != test.value {
+			t.Errorf("%q: round trip yields %q", test.value, formatted)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]float64{
+		"$1,234.50": 1234.50,
+		"($2.75)":   -2.75,
+		"-$0.30":    -0.30,
+		"+$5.00":    5.00,
+		"$0.30-":    -0.30,
+		"":          0.0,
+	}
+	for value, want := range tests {
+		got, err := parseAmount(value)
+		if err != nil {
+			t.Errorf("%q: %v", value, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %.2f, got %.2f", value, want, got)
+		}
+	}
+	if _, err := parseAmount("two dollars"); err == nil {
+		t.Errorf("expected an error for a malformed amount")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	raw := []byte(csvHeader + `Jan-30-2018 09:15 AM,Tap in at Main St,Stored Value,,-$2.10,$17.90,,,,,
+Jan-30-2018 10:15 AM,Tap in at Main St,Stored Value,,-$2.10,$15.80,,,,,
+Jan-32-2018 11:15 AM,Tap in at Main St,Stored Value,,-$2.10,$13.70,,,,,
+Jan-30-2018 12:15 PM,Tap in at Main St,Stored Value,,-$2.10,$11.60,,,,,
+`)
+	_, err := Parse(raw)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if parseErr.Row != 2 || parseErr.Field != "DateTime" || parseErr.Value != "Jan-32-2018 11:15 AM" {
+		t.Errorf("unexpected error %v", parseErr)
+	}
+}
+
+func TestWriteCSVRoundTrip(t *testing.T) {
+	raw := fixture(t, "usage-orders.csv")
+	records, err := Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	if header := strings.SplitN(buf.String(), "\n", 2)[0]; header != strings.SplitN(string(raw), "\n", 2)[0] {
+		t.Errorf("unexpected header %q", header)
+	}
+	again, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, again) {
+		t.Errorf("expected identical records after a round trip:\n%+v\n%+v", records, again)
+	}
+}
+
+func TestParseDaylightSavingTime(t *testing.T) {
+	records, err := Parse([]byte(csvHeader +
+		"Mar-11-2018 01:30 AM,Tap in at Main St,Stored Value,,-$2.10,$17.90,,,,,\n" +
+		"Mar-11-2018 03:30 AM,Tap in at Main St,Stored Value,,-$2.10,$15.80,,,,,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, after := records[0], records[1]
+	if want := time.Date(2018, time.March, 11, 9, 30, 0, 0, time.UTC); !before.DateTime.Equal(want) {
+		t.Errorf("expected PST %v, got %v", want, before.DateTime.UTC())
+	}
+	if want := time.Date(2018, time.March, 11, 10, 30, 0, 0, time.UTC); !after.DateTime.Equal(want) {
+		t.Errorf("expected PDT %v, got %v", want, after.DateTime.UTC())
+	}
+	if d := after.DateTime.Sub(before.DateTime); d != time.Hour {
+		t.Errorf("expected an hour between both taps, got %s", d)
+	}
+}
+
+func TestParseBOM(t *testing.T) {
+	records, err := Parse(fixture(t, "usage-bom.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if want := time.Date(2018, time.January, 30, 9, 15, 0, 0, Vancouver); !records[0].DateTime.Equal(want) {
+		t.Errorf("expected the first record at %v, got %v", want, records[0].DateTime)
+	}
+	if records[1].Total != "" || records[1].BalanceDetails != 15.80 {
+		t.Errorf("expected the line ending to be stripped, got %+v", records[1])
+	}
+}
+
+func TestParseColumnCounts(t *testing.T) {
+	raw := []byte(csvHeader +
+		"Jan-30-2018 09:15 AM,Tap in at Main St,Stored Value,,-$2.10,$17.90,,,\n" +
+		"Jan-30-2018 06:08 PM,Tap in at Bus Stop 60980,Stored Value,,-$2.10,$15.80,,,,,,unexpected\n")
+	records, err := Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Total != "" || records[1].BalanceDetails != 15.80 {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	var parseErr *ParseError
+	if _, err := Parse([]byte(csvHeader + "Jan-30-2018 09:15 AM,Tap in at Main St,Stored Value,,-$2.10\n")); !errors.As(err, &parseErr) {
+		t.Errorf("expected a row without BalanceDetails to be rejected, got %v", err)
+	}
+}
+
+func TestParseTrimsFields(t *testing.T) {
+	records, err := Parse([]byte(csvHeader + " Jan-30-2018 09:15 AM, Tap in at Main St , Stored Value ,\u00a0Web Order\u00a0,-$2.10,$17.90,, Visa ,,,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := records[0]
+	if record.Transaction != "Tap in at Main St" || record.Product != "Stored Value" || record.LineItem != "Web Order" || record.Payment != "Visa" {
+		t.Errorf("expected trimmed fields, got %q, %q, %q, %q", record.Transaction, record.Product, record.LineItem, record.Payment)
+	}
+}
+
+func TestParseAmountCurrencyTokens(t *testing.T) {
+	tests := map[string]float64{
+		"12.50 CAD":  12.50,
+		"CAD 12.50":  12.50,
+		"$12.50":     12.50,
+		"-12.50 CAD": -12.50,
+	}
+	for value, want := range tests {
+		if got, err := parseAmount(value); err != nil || got != want {
+			t.Errorf("%q: expected %.2f, got %.2f, %v", value, want, got, err)
+		}
+	}
+
+	defer func(tokens []string) { CurrencyTokens = tokens }(CurrencyTokens)
+	CurrencyTokens = []string{"€"}
+	if got, err := parseAmount("€12.50"); err != nil || got != 12.50 {
+		t.Errorf("expected a custom token to be stripped, got %.2f, %v", got, err)
+	}
+	if _, err := parseAmount("$12.50"); err == nil {
+		t.Errorf("expected $ to be unknown once CurrencyTokens is overridden")
+	}
+}
+
+func TestParseSubsidyColumn(t *testing.T) {
+	records, err := Parse(fixture(t, "usage-subsidy.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	purchase, tap := records[0], records[1]
+	if purchase.Product != "Monthly Pass 1 Zone" || purchase.LineItem != "Web Order" || purchase.RawAmount != 49 || purchase.BalanceDetails != 17.90 {
+		t.Errorf("unexpected purchase %+v", purchase)
+	}
+	if purchase.OrderDate != "2018-01-01" || purchase.Payment != "Employer Program" || purchase.OrderNumber != "12345" || purchase.AuthCode != "A1B2C3" || purchase.Total != "$49.00" {
+		t.Errorf("unexpected order details of %+v", purchase)
+	}
+	if tap.Amount != -2.10 || tap.BalanceDetails != 15.80 || tap.Payment != "" {
+		t.Errorf("unexpected tap %+v", tap)
+	}
+}
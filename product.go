@@ -0,0 +1,44 @@
+package compasscard
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// passMonth matches the month a pass is valid for, e.g. "Monthly Pass 1 Zone Oct 2019"
+var passMonth = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?[ -](\d{4})\b`)
+
+// ProductExpiry returns the last instant a product bought by r is valid.
+// Monthly passes naming their month expire at the end of it, day passes at
+// the end of the day they were bought and weekly passes at the end of the
+// sixth day after. Other products report false
+func ProductExpiry(r UsageRecord) (time.Time, bool) {
+	product := strings.ToLower(r.Product)
+	if !strings.Contains(product, "pass") {
+		return time.Time{}, false
+	}
+	if m := passMonth.FindStringSubmatch(r.Product); m != nil {
+		month, err := time.ParseInLocation("Jan 2006", strings.ToUpper(m[1][:1])+strings.ToLower(m[1][1:])+" "+m[2], Vancouver)
+		if err == nil {
+			return month.AddDate(0, 1, 0).Add(-time.Second), true
+		}
+	}
+	switch {
+	case strings.Contains(product, "day"):
+		return validFor(r, 1), true
+	case strings.Contains(product, "week"):
+		return validFor(r, 7), true
+	}
+	return time.Time{}, false
+}
+
+// validFor returns the end of the last of days calendar days, counting the
+// day r was ordered, or made if the order date is unknown
+func validFor(r UsageRecord, days int) time.Time {
+	bought := r.OrderedAt
+	if bought.IsZero() {
+		bought = r.DateTime
+	}
+	return startOfDay(bought.In(Vancouver)).AddDate(0, 0, days).Add(-time.Second)
+}
@@ -0,0 +1,55 @@
+package compasscard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseOrderDate(t *testing.T) {
+	tests := map[string]time.Time{
+		"Jan-30-2018 06:08 PM": time.Date(2018, time.January, 30, 18, 8, 0, 0, Vancouver),
+		"2018-01-30":           time.Date(2018, time.January, 30, 0, 0, 0, 0, Vancouver),
+		"03/04/2018":           {},
+		"":                     {},
+	}
+	for value, want := range tests {
+		if got := parseOrderDate(value); !got.Equal(want) {
+			t.Errorf("%q: expected %v, got %v", value, want, got)
+		}
+	}
+}
+
+func TestProductExpiry(t *testing.T) {
+	expiry, ok := ProductExpiry(UsageRecord{Product: "Monthly Pass 1 Zone OCT 2019"})
+	if want := time.Date(2019, time.November, 1, 0, 0, 0, 0, Vancouver).Add(-time.Second); !ok || !expiry.Equal(want) {
+		t.Errorf("expected %v, got %v, %v", want, expiry, ok)
+	}
+}
+
+func TestProductExpiryFixture(t *testing.T) {
+	records, err := Parse(fixture(t, "usage-passes.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	endOf := func(month time.Month, day int) time.Time {
+		return time.Date(2018, month, day+1, 0, 0, 0, 0, Vancouver).Add(-time.Second)
+	}
+	tests := []struct {
+		want time.Time
+		ok   bool
+	}{
+		{endOf(time.February, 28), true},
+		{endOf(time.February, 3), true},
+		{endOf(time.February, 11), true},
+		{time.Time{}, false},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("expected %d records, got %d", len(tests), len(records))
+	}
+	for i, test := range tests {
+		expiry, ok := ProductExpiry(records[i])
+		if ok != test.ok || !expiry.Equal(test.want) {
+			t.Errorf("%s: expected %v, %v, got %v, %v", records[i].Product, test.want, test.ok, expiry, ok)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package compasscard
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	handler, calls := serveFixtures(fixture(t, "usage.csv"))
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+	// throttle after signing in, so only the usage requests count
+	WithRateLimit(20).Apply(s)
+
+	begin := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, _, err := s.Usage("1234", january2018); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request passes immediately, every other one waits 50ms
+	if elapsed := time.Since(begin); elapsed < 200*time.Millisecond {
+		t.Errorf("expected %d requests to take at least 200ms, took %s", *calls, elapsed)
+	}
+}
+
+func TestWithRateLimitCanceled(t *testing.T) {
+	handler, calls := serveFixtures(fixture(t, "usage.csv"))
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+	// throttle after signing in, so only the usage requests count
+	WithRateLimit(0.1).Apply(s)
+
+	if _, _, err := s.Usage("1234", january2018); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.UsageContext(ctx, "1234", january2018); err == nil {
+		t.Errorf("expected waiting for the limiter to fail with the context, got %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected a single request, got %d", *calls)
+	}
+}
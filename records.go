@@ -0,0 +1,54 @@
+package compasscard
+
+import "sort"
+
+// Deduplicate removes records which share DateTime, Transaction and Amount
+// with an earlier record. Use it to post-process the output of Parse when
+// statements overlap
+func Deduplicate(records []UsageRecord) []UsageRecord {
+	type key struct {
+		at          int64
+		transaction string
+		amount      float64
+	}
+	seen := map[key]bool{}
+	unique := []UsageRecord{}
+	for _, record := range records {
+		k := key{record.DateTime.UnixNano(), record.Transaction, record.Amount}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, record)
+	}
+	return unique
+}
+
+// SortByDate orders records ascending by DateTime in place, keeping the
+// original order of records with the same DateTime
+func SortByDate(records []UsageRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].DateTime.Before(records[j].DateTime)
+	})
+}
+
+// GroupByDay buckets records by calendar day in Vancouver time, keyed like
+// 2006-01-02. Records keep their relative order within each bucket
+func GroupByDay(records []UsageRecord) map[string][]UsageRecord {
+	return groupBy(records, "2006-01-02")
+}
+
+// GroupByMonth buckets records by calendar month in Vancouver time, keyed
+// like 2006-01. Records keep their relative order within each bucket
+func GroupByMonth(records []UsageRecord) map[string][]UsageRecord {
+	return groupBy(records, "2006-01")
+}
+
+func groupBy(records []UsageRecord, layout string) map[string][]UsageRecord {
+	groups := map[string][]UsageRecord{}
+	for _, record := range records {
+		key := record.DateTime.In(Vancouver).Format(layout)
+		groups[key] = append(groups[key], record)
+	}
+	return groups
+}
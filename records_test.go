@@ -0,0 +1,40 @@
+package compasscard
+
+import (
+	"testing"
+	"time"
+)
+
+func record(hour int, transaction string, amount float64) UsageRecord {
+	return UsageRecord{
+		DateTime:    time.Date(2018, time.January, 30, hour, 0, 0, 0, Vancouver),
+		Transaction: transaction,
+		Amount:      amount,
+	}
+}
+
+func TestDeduplicateAndSort(t *testing.T) {
+	records := []UsageRecord{
+		record(18, "Tap in at Bus Stop 60980", -2.10),
+		record(9, "Tap in at Main St", -2.10),
+		record(18, "Tap in at Bus Stop 60980", -2.10),
+		record(9, "Tap out at Waterfront Stn", 0),
+		record(9, "Tap in at Main St", -2.10),
+		record(12, "Loaded", 20),
+	}
+	unique := Deduplicate(records)
+	if len(unique) != 4 {
+		t.Fatalf("expected 4 unique records, got %d", len(unique))
+	}
+	if unique[0].Transaction != "Tap in at Bus Stop 60980" {
+		t.Errorf("expected Deduplicate to keep the original order, got %q first", unique[0].Transaction)
+	}
+
+	SortByDate(unique)
+	want := []string{"Tap in at Main St", "Tap out at Waterfront Stn", "Loaded", "Tap in at Bus Stop 60980"}
+	for i, transaction := range want {
+		if unique[i].Transaction != transaction {
+			t.Errorf("record %d: expected %q, got %q", i, transaction, unique[i].Transaction)
+		}
+	}
+}
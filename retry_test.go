@@ -0,0 +1,57 @@
+package compasscard
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failing answers the first n requests with status, then serves usage
+func failing(t *testing.T, n, status int) (http.Handler, *int) {
+	usage := fixture(t, "usage.csv")
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls <= n {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Write(usage)
+	}), &calls
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	handler, calls := failing(t, 2, http.StatusBadGateway)
+	s, srv := newTestSession(t, handler, WithRetry(3, time.Millisecond))
+	defer srv.Close()
+
+	records, _, err := s.Usage("1234", january2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || *calls != 3 {
+		t.Errorf("expected 2 records after 3 requests, got %d after %d", len(records), *calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	handler, calls := failing(t, 5, http.StatusBadGateway)
+	s, srv := newTestSession(t, handler, WithRetry(3, time.Millisecond))
+	defer srv.Close()
+
+	var statusErr *StatusError
+	if _, _, err := s.Usage("1234", january2018); !errors.As(err, &statusErr) || *calls != 3 {
+		t.Errorf("expected a StatusError after 3 requests, got %v after %d", err, *calls)
+	}
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	handler, calls := failing(t, 1, http.StatusNotFound)
+	s, srv := newTestSession(t, handler, WithRetry(3, time.Millisecond))
+	defer srv.Close()
+
+	if _, _, err := s.Usage("1234", january2018); err == nil || *calls != 1 {
+		t.Errorf("expected a 404 to fail without retrying, got %v after %d requests", err, *calls)
+	}
+}
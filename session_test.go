@@ -0,0 +1,72 @@
+package compasscard
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPostActionRefreshesTokens(t *testing.T) {
+	posts, tokens := 0, []string{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodPost:
+			posts++
+			req.ParseForm()
+			tokens = append(tokens, req.PostForm.Get("__CSRFTOKEN"))
+			if req.PostForm.Get("__CSRFTOKEN") != "fresh" {
+				http.Redirect(w, req, "/SignIn", http.StatusFound)
+				return
+			}
+			fmt.Fprintf(w, signInPage, "ctl00$Content$passwordInfo$txtPassword")
+		default:
+			fmt.Fprint(w, strings.Replace(fmt.Sprintf(manageCardsPage, ""), `value="csrf"`, `value="fresh"`, 1))
+		}
+	})
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+	s.csrfToken = "expired"
+
+	if err := s.Signout(); err != nil {
+		t.Fatal(err)
+	}
+	if posts != 2 || tokens[1] != "fresh" {
+		t.Errorf("expected a single retry with fresh tokens, got %d posts with %q", posts, tokens)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/SignIn", http.StatusFound)
+	})
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	if _, err := s.Cards(); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Cards: expected ErrSessionExpired, got %v", err)
+	}
+	if _, _, err := s.Usage("1234", january2018); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Usage: expected ErrSessionExpired, got %v", err)
+	}
+	if _, err := s.UsagePDF("1234", january2018); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("UsagePDF: expected ErrSessionExpired, got %v", err)
+	}
+}
+
+func TestSessionExpiredBody(t *testing.T) {
+	// some responses render the sign in form without redirecting
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, signInPage, "ctl00$Content$passwordInfo$txtPassword")
+	})
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	if _, err := s.Cards(); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Cards: expected ErrSessionExpired, got %v", err)
+	}
+	if _, _, err := s.Usage("1234", january2018); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Usage: expected ErrSessionExpired, got %v", err)
+	}
+}
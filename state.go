@@ -0,0 +1,45 @@
+package compasscard
+
+import "net/http"
+
+// SessionState bundles the cookie jar and form tokens of a signed in Session
+type SessionState struct {
+	Jar                http.CookieJar
+	CSRFToken          string // __CSRFTOKEN
+	EventValidation    string // __EVENTVALIDATION
+	ViewState          string // __VIEWSTATE
+	ViewStateGenerator string // __VIEWSTATEGENERATOR
+}
+
+// State captures the cookie jar and form tokens of s, e.g. to create further
+// Sessions for the same account with NewWithState
+func (s *Session) State() SessionState {
+	state := SessionState{
+		CSRFToken:          s.csrfToken,
+		EventValidation:    s.evntValidation,
+		ViewState:          s.evntState,
+		ViewStateGenerator: s.evntGenerator,
+	}
+	if s.client != nil {
+		state.Jar = s.client.Jar
+	}
+	return state
+}
+
+// NewWithState creates a Session from a state captured via State without
+// fetching SignIn or signing in. The tokens are copied, while the cookie jar is
+// shared: the default jar is safe for concurrent use, so Sessions created from
+// the same state can be used from different goroutines. Options are applied
+// before the state, so WithCookieJar and WithHTTPClient don't replace its jar
+func NewWithState(state SessionState, options ...ClientOption) (*Session, error) {
+	if state.Jar == nil {
+		return nil, errNoCookieJar
+	}
+	s := newSession(options)
+	s.client.Jar = state.Jar
+	s.csrfToken = state.CSRFToken
+	s.evntValidation = state.EventValidation
+	s.evntState = state.ViewState
+	s.evntGenerator = state.ViewStateGenerator
+	return s, nil
+}
@@ -0,0 +1,56 @@
+package compasscard
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Statement holds the metadata found in the header row of a compass card csv
+type Statement struct {
+	CardSerial string
+	CardHolder string
+	Period     string
+	Columns    []string
+}
+
+// ParseStatement is like Parse but also returns the statement header.
+// Header cells of the form "Key: Value" are treated as metadata, all other
+// cells as column names. A plain column list yields empty metadata
+func ParseStatement(raw []byte) (Statement, []UsageRecord, error) {
+	statement := Statement{}
+	lines := []UsageRecord{}
+	err := parseCSV(bytes.NewReader(raw), func(header []string) {
+		statement = parseStatementHeader(header)
+	}, func(record UsageRecord) error {
+		lines = append(lines, record)
+		return nil
+	}, nil)
+	if err != nil {
+		return Statement{}, nil, err
+	}
+	return statement, lines, nil
+}
+
+func parseStatementHeader(header []string) Statement {
+	statement := Statement{Columns: []string{}}
+	for _, cell := range header {
+		parts := strings.SplitN(cell, ":", 2)
+		if len(parts) != 2 {
+			statement.Columns = append(statement.Columns, strings.TrimSpace(cell))
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		switch {
+		case strings.Contains(key, "serial") || strings.Contains(key, "card number"):
+			statement.CardSerial = value
+		case strings.Contains(key, "name") || strings.Contains(key, "holder"):
+			statement.CardHolder = value
+		case strings.Contains(key, "period") || strings.Contains(key, "date range"):
+			statement.Period = value
+		default:
+			statement.Columns = append(statement.Columns, strings.TrimSpace(cell))
+		}
+	}
+	return statement
+}
@@ -0,0 +1,32 @@
+package compasscard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func maintenance(w http.ResponseWriter, req *http.Request) {
+	http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+}
+
+func TestStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(maintenance))
+	defer srv.Close()
+
+	_, err := New("user@example.com", "secret", WithEndpoint(srv.URL))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("New: expected a 503 StatusError, got %v", err)
+	}
+
+	s, srv := newTestSession(t, http.HandlerFunc(maintenance))
+	defer srv.Close()
+	if _, err := s.Cards(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Cards: expected a 503 StatusError, got %v", err)
+	}
+	if _, _, err := s.Usage("1234", january2018); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Usage: expected a 503 StatusError, got %v", err)
+	}
+}
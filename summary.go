@@ -0,0 +1,82 @@
+package compasscard
+
+import (
+	"sort"
+	"time"
+)
+
+// Summary aggregates the spend and loads of a set of records
+type Summary struct {
+	TotalSpent  float64 // sum of negative amounts, as a positive number
+	TotalLoaded float64 // sum of positive amounts
+	TapCount    int
+	FirstRecord time.Time
+	LastRecord  time.Time
+}
+
+// Summarize totals records. An empty slice yields a zero Summary
+func Summarize(records []UsageRecord) Summary {
+	summary := Summary{}
+	for i, record := range records {
+		if record.Amount < 0 {
+			summary.TotalSpent -= record.Amount
+		} else {
+			summary.TotalLoaded += record.Amount
+		}
+		if isTapIn(record) || isTapOut(record) {
+			summary.TapCount++
+		}
+		if i == 0 || record.DateTime.Before(summary.FirstRecord) {
+			summary.FirstRecord = record.DateTime
+		}
+		if i == 0 || record.DateTime.After(summary.LastRecord) {
+			summary.LastRecord = record.DateTime
+		}
+	}
+	return summary
+}
+
+// TopSpends returns up to n records with the most negative Amount, biggest
+// spend first. Equal spends are ordered by DateTime. records is not modified
+func TopSpends(records []UsageRecord, n int) []UsageRecord {
+	spends := []UsageRecord{}
+	for _, record := range records {
+		if record.Amount < 0 {
+			spends = append(spends, record)
+		}
+	}
+	sort.SliceStable(spends, func(i, j int) bool {
+		if spends[i].Amount != spends[j].Amount {
+			return spends[i].Amount < spends[j].Amount
+		}
+		return spends[i].DateTime.Before(spends[j].DateTime)
+	})
+	if n < 0 {
+		n = 0
+	}
+	if n < len(spends) {
+		spends = spends[:n]
+	}
+	return spends
+}
+
+// ModeUnknown collects records without a detectable mode in SummarizeByMode
+const ModeUnknown = "unknown"
+
+// SummarizeByMode buckets records by the mode reported by Location and
+// summarizes every bucket
+func SummarizeByMode(records []UsageRecord) map[string]Summary {
+	byMode := map[string][]UsageRecord{}
+	for _, record := range records {
+		mode, _ := Location(record)
+		if mode == "" {
+			mode = ModeUnknown
+		}
+		byMode[mode] = append(byMode[mode], record)
+	}
+	summaries := map[string]Summary{}
+	for mode, records := range byMode {
+		summaries[mode] = Summarize(records)
+	}
+	return summaries
+}
@@ -0,0 +1,244 @@
+package compasscard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(&fakeSite{cards: []string{"1234"}})
+	defer srv.Close()
+
+	requests := 0
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests++
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	}
+	s, err := New("user@example.com", "secret", WithHTTPClient(client), WithEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests == 0 {
+		t.Errorf("expected sign in to use the injected client")
+	}
+	if s.client.Timeout != 30*time.Second || s.client.Jar == nil {
+		t.Errorf("expected the timeout and a cookie jar, got %v and %v", s.client.Timeout, s.client.Jar)
+	}
+	if client.Jar != nil {
+		t.Errorf("expected the injected client to be left untouched")
+	}
+
+	if _, err := New("user@example.com", "wrong", WithHTTPClient(client), WithEndpoint(srv.URL)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestWithTransportKeepsCookies(t *testing.T) {
+	site := &fakeSite{cards: []string{"1234"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && req.URL.Path == "/SignIn" {
+			http.SetCookie(w, &http.Cookie{Name: "ASP.NET_SessionId", Value: "session", Path: "/"})
+		} else if c, err := req.Cookie("ASP.NET_SessionId"); err != nil || c.Value != "session" {
+			http.Error(w, "missing session cookie", http.StatusForbidden)
+			return
+		}
+		site.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	requests := 0
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	s, err := New("user@example.com", "secret", WithEndpoint(srv.URL), WithTransport(rt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards, err := s.Cards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 1 || requests != 3 {
+		t.Errorf("expected 1 card after 3 requests through the transport, got %d after %d", len(cards), requests)
+	}
+}
+
+func TestWithClientTrace(t *testing.T) {
+	handler, _ := serveFixtures(fixture(t, "usage.csv"))
+	var mu sync.Mutex
+	events := map[string]int{}
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[name]++
+	}
+	s, srv := newTestSession(t, handler, WithClientTrace(func() *httptrace.ClientTrace {
+		return &httptrace.ClientTrace{
+			GetConn:              func(string) { record("GetConn") },
+			GotFirstResponseByte: func() { record("GotFirstResponseByte") },
+		}
+	}))
+	defer srv.Close()
+	// only count the usage request, signing in reuses the connection
+	mu.Lock()
+	events = map[string]int{}
+	mu.Unlock()
+
+	if _, _, err := s.Usage("1234", january2018); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"GetConn", "GotFirstResponseByte"} {
+		if events[name] != 1 {
+			t.Errorf("expected %s to fire once, got %d", name, events[name])
+		}
+	}
+}
+
+// countingBody reports its Close to the counters of the transport, including
+// whether it was read to the end beforehand
+type countingBody struct {
+	io.ReadCloser
+	open, undrained *int32
+	eof             bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.eof = b.eof || err == io.EOF
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	atomic.AddInt32(b.open, -1)
+	if !b.eof {
+		atomic.AddInt32(b.undrained, 1)
+	}
+	return b.ReadCloser.Close()
+}
+
+func TestResponseBodiesClosed(t *testing.T) {
+	site := &fakeSite{cards: []string{"1234"}, usage: fixture(t, "usage.csv")}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ccsn") == "5678" {
+			maintenance(w, req)
+			return
+		}
+		site.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	var open, undrained int32
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err == nil {
+			atomic.AddInt32(&open, 1)
+			resp.Body = &countingBody{ReadCloser: resp.Body, open: &open, undrained: &undrained}
+		}
+		return resp, err
+	})
+	s, err := New("user@example.com", "secret", WithEndpoint(srv.URL), WithTransport(rt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Cards()
+	s.Usage("1234", january2018)
+	s.Usage("5678", january2018)
+	s.UsagePDF("1234", january2018)
+	s.Close()
+
+	if n := atomic.LoadInt32(&open); n != 0 {
+		t.Errorf("expected every response body to be closed, %d are open", n)
+	}
+	if n := atomic.LoadInt32(&undrained); n != 0 {
+		t.Errorf("expected every response body to be drained, %d were not", n)
+	}
+}
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestWithTransportTuning(t *testing.T) {
+	s := newSession([]ClientOption{WithTransportTuning(10, 4)})
+	transport, ok := s.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport, got %T", s.client.Transport)
+	}
+	if transport.MaxIdleConns != 10 || transport.MaxConnsPerHost != 4 || transport.MaxIdleConnsPerHost != 4 {
+		t.Errorf("unexpected limits %d, %d, %d", transport.MaxIdleConns, transport.MaxConnsPerHost, transport.MaxIdleConnsPerHost)
+	}
+	if s.client.Jar == nil {
+		t.Errorf("expected the cookie jar to be kept")
+	}
+
+	custom := &http.Transport{TLSHandshakeTimeout: time.Second}
+	s = newSession([]ClientOption{WithTransport(custom), WithTransportTuning(10, 4)})
+	if tuned := s.client.Transport.(*http.Transport); tuned == custom || tuned.TLSHandshakeTimeout != time.Second {
+		t.Errorf("expected a tuned copy of the custom transport")
+	}
+}
+
+func TestWithTransportTuningKeepsRoundTripper(t *testing.T) {
+	logger := &recordingLogger{}
+	called := false
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+		return nil, fmt.Errorf("offline")
+	})
+	s := newSession([]ClientOption{WithLogger(logger), WithTransport(rt), WithTransportTuning(10, 4)})
+	s.client.Get("http://example.com")
+	if !called {
+		t.Errorf("expected the custom round tripper to be kept")
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "WithTransportTuning") {
+		t.Errorf("expected the ignored tuning to be logged, got %q", logger.lines)
+	}
+}
+
+// BenchmarkUsageAll fetches 16 cards with WithConcurrency(16) from a server
+// answering after 5ms, varying the connections allowed per host
+func BenchmarkUsageAll(b *testing.B) {
+	body := []byte("DateTime,Transaction,Product,LineItem,Amount,BalanceDetails,OrderDate,Payment,OrderNumber,AuthCode,Total\n" +
+		"Jan-30-2018 09:15 AM,Tap in at Main St,Stored Value,,-$2.10,$17.90,,,,,\n")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Write(body)
+	})
+	ccsns := []string{}
+	for i := 0; i < 16; i++ {
+		ccsns = append(ccsns, fmt.Sprintf("%d", 1000+i))
+	}
+
+	for _, conns := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("MaxConnsPerHost=%d", conns), func(b *testing.B) {
+			s, srv := newTestSession(b, handler, WithConcurrency(16), WithTransportTuning(conns, conns))
+			defer srv.Close()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.UsageAll(context.Background(), ccsns, january2018); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package compasscard
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUsageAllConcurrency(t *testing.T) {
+	usage := fixture(t, "usage.csv")
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write(usage)
+	})
+	s, srv := newTestSession(t, handler, WithConcurrency(2))
+	defer srv.Close()
+
+	ccsns := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+	all, err := s.UsageAll(context.Background(), ccsns, january2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(ccsns) {
+		t.Errorf("expected usage of %d cards, got %d", len(ccsns), len(all))
+	}
+	if peak != 2 {
+		t.Errorf("expected at most 2 concurrent requests, got %d", peak)
+	}
+}
+
+func TestUsageAllFirstError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ccsn") == "2" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		<-req.Context().Done()
+	})
+	s, srv := newTestSession(t, handler, WithConcurrency(4))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var statusErr *StatusError
+	if _, err := s.UsageAll(ctx, []string{"1", "2", "3"}, january2018); !errors.As(err, &statusErr) {
+		t.Errorf("expected the 404 to cancel the other lookups, got %v", err)
+	}
+}
+
+func TestUsageOptionsNormalized(t *testing.T) {
+	afternoon := time.Date(2024, time.January, 15, 14, 30, 0, 0, Vancouver)
+	q := usageQuery("1234", UsageOptions{StartDate: afternoon, EndDate: afternoon})
+	if start := q.Get("start"); start != "15/01/2024 00:00:00 AM" {
+		t.Errorf("expected the start of the 15th, got %q", start)
+	}
+	if end := q.Get("end"); end != "15/01/2024 23:59:59 PM" {
+		t.Errorf("expected the end of the 15th, got %q", end)
+	}
+}
+
+func TestUsageGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(fixture(t, "usage.csv"))
+	zw.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("expected gzip to be accepted, got %q", req.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	})
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	records, raw, err := s.Usage("1234", january2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || !bytes.Equal(raw, fixture(t, "usage.csv")) {
+		t.Errorf("expected the decompressed statement, got %d records from %q", len(records), raw)
+	}
+}
+
+func TestUsageRetriesEmptyStatement(t *testing.T) {
+	handler, calls := serveFixtures(fixture(t, "usage-empty.csv"), fixture(t, "usage.csv"))
+	s, srv := newTestSession(t, handler, WithRetry(2, time.Millisecond))
+	defer srv.Close()
+
+	records, _, err := s.Usage("1234", january2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || *calls != 2 {
+		t.Errorf("expected 2 records after 2 requests, got %d after %d", len(records), *calls)
+	}
+}
+
+func TestUsageEmptyStatement(t *testing.T) {
+	handler, calls := serveFixtures(fixture(t, "usage-empty.csv"))
+	s, srv := newTestSession(t, handler, WithRetry(2, time.Millisecond))
+	defer srv.Close()
+
+	if _, _, err := s.Usage("1234", january2018); !errors.Is(err, ErrNoData) {
+		t.Errorf("expected ErrNoData, got %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected a single retry, got %d requests", *calls)
+	}
+
+	records, err := s.UsageRange("1234", january2018.StartDate, january2018.EndDate)
+	if err != nil || len(records) != 0 {
+		t.Errorf("expected UsageRange to return no records, got %v, %v", records, err)
+	}
+	usage, err := s.UsageAll(context.Background(), []string{"1234", "5678"}, january2018)
+	if err != nil || len(usage) != 2 || len(usage["1234"]) != 0 {
+		t.Errorf("expected UsageAll to return empty usage for both cards, got %v, %v", usage, err)
+	}
+}
+
+func TestUsageEmptyStatementWithoutRetry(t *testing.T) {
+	handler, calls := serveFixtures(fixture(t, "usage-empty.csv"))
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	records, _, err := s.Usage("1234", january2018)
+	if err != nil || len(records) != 0 || *calls != 1 {
+		t.Errorf("expected no records from a single request, got %v, %v after %d", records, err, *calls)
+	}
+}
+
+func TestUsageYear(t *testing.T) {
+	handler, calls := serveFixtures(fixture(t, "usage.csv"))
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	records, err := s.UsageYear("1234", 2018)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 12 {
+		t.Errorf("expected one request per month, got %d", *calls)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected duplicate records to be merged, got %d", len(records))
+	}
+}
+
+func TestUsageReturnsRawOnParseError(t *testing.T) {
+	handler, _ := serveFixtures(fixture(t, "usage-malformed.csv"))
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	_, raw, err := s.Usage("1234", january2018)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	records, skipped := ParseLenient(raw)
+	if len(records) != 1 || len(skipped) != 1 {
+		t.Errorf("expected 1 record and 1 skipped row, got %d and %d", len(records), len(skipped))
+	}
+}
+
+func TestUsageWithResponseStatusError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	s, srv := newTestSession(t, handler)
+	defer srv.Close()
+
+	_, _, resp, err := s.UsageWithResponse("1234", january2018)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a StatusError, got %v", err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("X-Request-Id") != "abc" {
+		t.Errorf("expected the response alongside the error, got %v", resp)
+	}
+}
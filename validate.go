@@ -0,0 +1,71 @@
+package compasscard
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidationError describes an inconsistency between fields of a record
+type ValidationError struct {
+	Index    int    // index of the record in the validated slice
+	Field    string // Total or BalanceDetails
+	Expected float64
+	Actual   float64
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("compasscard: record %d: %s is %.2f, expected %.2f", e.Index, e.Field, e.Actual, e.Expected)
+}
+
+const centEpsilon = 0.005
+
+// Validate checks records for schema drift. A non-empty Total has to match
+// the Amount, and the BalanceDetails of every record has to equal the
+// previous balance plus its Amount, in chronological order. Purchases and
+// products other than stored value don't change the balance and are skipped.
+// Unparseable Totals are reported as ParseErrors
+func Validate(records []UsageRecord) []error {
+	errs := []error{}
+	for i, record := range records {
+		if record.Total == "" {
+			continue
+		}
+		total, err := parseAmount(record.Total)
+		if err != nil {
+			errs = append(errs, &ParseError{Row: i, Field: "Total", Value: record.Total, Err: err})
+			continue
+		}
+		if math.Abs(math.Abs(total)-math.Abs(record.Amount)) > centEpsilon {
+			errs = append(errs, &ValidationError{Index: i, Field: "Total", Expected: math.Abs(record.Amount), Actual: math.Abs(total)})
+		}
+	}
+
+	order := []int{}
+	for i, record := range records {
+		if changesStoredValue(record) {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return records[order[i]].DateTime.Before(records[order[j]].DateTime)
+	})
+	for k := 1; k < len(order); k++ {
+		previous, current := records[order[k-1]], records[order[k]]
+		expected := previous.BalanceDetails + current.Amount
+		if math.Abs(expected-current.BalanceDetails) > centEpsilon {
+			errs = append(errs, &ValidationError{Index: order[k], Field: "BalanceDetails", Expected: expected, Actual: current.BalanceDetails})
+		}
+	}
+	return errs
+}
+
+// changesStoredValue reports whether a record moves the stored value balance.
+// Records without a Product are assumed to be stored value
+func changesStoredValue(r UsageRecord) bool {
+	if Classify(r) == Purchase {
+		return false
+	}
+	return r.Product == "" || strings.EqualFold(r.Product, "Stored Value")
+}
@@ -0,0 +1,26 @@
+package compasscard
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	records, err := Parse([]byte(csvHeader +
+		"Jan-30-2018 08:00 AM,Tap in at Main St,Stored Value,,-$2.75,$7.25,,,,,\n" +
+		"Jan-30-2018 09:00 AM,Purchase,Monthly Pass 1 Zone,Web Order,$98.00,$7.25,2018-01-29,Visa,12345,A1B2C3,$98.00\n" +
+		"Jan-30-2018 10:00 AM,Loaded,Stored Value,Web Order,$20.00,$27.25,2018-01-29,Visa,12346,A1B2C4,$20.00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := Validate(records); len(errs) != 0 {
+		t.Errorf("expected the pass purchase to be skipped, got %v", errs)
+	}
+
+	records[2].BalanceDetails = 30
+	errs := Validate(records)
+	var validationErr *ValidationError
+	if len(errs) != 1 || !errors.As(errs[0], &validationErr) || validationErr.Index != 2 || validationErr.Expected != 27.25 {
+		t.Errorf("expected the reload to be reported, got %v", errs)
+	}
+}